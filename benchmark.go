@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/jdextraze/docker-machine-driver-vpsie/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultBenchmarkDownloadURL = "http://cachefly.cachefly.net/100mb.test"
+
+type benchmarkStep struct {
+	name    string
+	command string
+}
+
+var benchmarks = []benchmarkStep{
+	{"CPU (sha256 of 1 GB)", "dd if=/dev/zero bs=1M count=1024 2>/dev/null | sha256sum >/dev/null"},
+	{"Disk write (512 MB, fdatasync)", "dd if=/dev/zero of=/tmp/vpsie-benchmark bs=1M count=512 conv=fdatasync 2>&1 | tail -n 1; rm -f /tmp/vpsie-benchmark"},
+	{"Disk read (512 MB, uncached)", "dd if=/dev/zero of=/tmp/vpsie-benchmark bs=1M count=512 2>/dev/null && sync && echo 3 > /proc/sys/vm/drop_caches && dd if=/tmp/vpsie-benchmark of=/dev/null bs=1M 2>&1 | tail -n 1; rm -f /tmp/vpsie-benchmark"},
+}
+
+// benchmark creates a throwaway instance of the selected offer, runs a few
+// CPU, disk and network measurements over SSH and removes it.
+func benchmark(args []string) error {
+	storePath, err := ioutil.TempDir("", "vpsie-benchmark")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(storePath)
+
+	name := "vpsie-benchmark-" + mcnutils.TruncateID(mcnutils.GenerateRandomID())
+	d := driver.NewDriver(name, storePath)
+
+	fs := flag.NewFlagSet("benchmark", flag.ExitOnError)
+	downloadURL := fs.String("download-url", defaultBenchmarkDownloadURL, "URL downloaded to measure network throughput")
+	options := newFlagOptions(fs, d.GetCreateFlags())
+	fs.Parse(args)
+	if err := options.readStdinSecret(); err != nil {
+		return err
+	}
+
+	if err := d.SetConfigFromFlags(options); err != nil {
+		return err
+	}
+	if err := d.PreCreateCheck(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.GetSSHKeyPath()), 0700); err != nil {
+		return err
+	}
+
+	if err := d.Create(); err != nil {
+		if d.InstanceID != "" {
+			d.Remove()
+		}
+		return err
+	}
+	defer func() {
+		log.Infof("Removing benchmark machine %s...", name)
+		if err := d.Remove(); err != nil {
+			log.Errorf("Error removing benchmark machine %s (%s): %s", name, d.InstanceID, err)
+		}
+	}()
+
+	steps := append([]benchmarkStep{}, benchmarks...)
+	steps = append(steps, benchmarkStep{
+		"Network download",
+		fmt.Sprintf("curl -s -o /dev/null -w '%%{speed_download} bytes/s' %[1]s || wget -O /dev/null %[1]s 2>&1 | tail -n 2", *downloadURL),
+	})
+
+	fmt.Printf("Benchmark results for offer %s:\n", d.OfferID)
+	for _, b := range steps {
+		start := time.Now()
+		out, err := d.RunAsRoot(b.command)
+		if err != nil {
+			fmt.Printf("  %-32s error: %s\n", b.name, err)
+			continue
+		}
+		fmt.Printf("  %-32s %8.2fs  %s\n", b.name, time.Since(start).Seconds(), out)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/jdextraze/docker-machine-driver-vpsie/driver"
+	"os"
+	"text/tabwriter"
+)
+
+type catalogEntry struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name,omitempty"`
+
+	Category string `json:"category,omitempty"`
+	Country  string `json:"country,omitempty"`
+	State    string `json:"state,omitempty"`
+
+	CPU     int `json:"cpu,omitempty"`
+	RAM     int `json:"ram,omitempty"`
+	SSD     int `json:"ssd,omitempty"`
+	Traffic int `json:"traffic,omitempty"`
+	Price   int `json:"price,omitempty"`
+}
+
+// listCatalog prints the IDs and names of a VPSie catalog, so images, offers
+// and datacenters can be chosen without calling the API by hand.
+func listCatalog(kind string) func(args []string) error {
+	return func(args []string) error {
+		d := driver.NewDriver("", storePath())
+
+		fs := flag.NewFlagSet("list-"+kind, flag.ExitOnError)
+		asJSON := fs.Bool("json", false, "Print JSON instead of a table")
+		options := newFlagOptions(fs, d.GetCreateFlags())
+		fs.Parse(args)
+		if err := options.readStdinSecret(); err != nil {
+			return err
+		}
+
+		if err := d.SetConfigFromFlags(options); err != nil {
+			return err
+		}
+
+		entries, header, err := catalogEntries(d, kind)
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(entries)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, header)
+		for _, e := range entries {
+			switch kind {
+			case "images":
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.ID, e.Slug, e.Name, e.Category)
+			case "offers":
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\n", e.ID, e.Slug, e.CPU, e.RAM, e.SSD, e.Traffic, e.Price)
+			case "datacenters":
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.ID, e.Slug, e.Name, e.Country, e.State)
+			}
+		}
+		return w.Flush()
+	}
+}
+
+func catalogEntries(d *driver.Driver, kind string) ([]catalogEntry, string, error) {
+	entries := []catalogEntry{}
+	switch kind {
+	case "images":
+		images, err := d.Images()
+		for _, image := range images {
+			entries = append(entries, catalogEntry{ID: image.Id, Slug: driver.Slugify(image.Name), Name: image.Name, Category: image.Category})
+		}
+		return entries, "ID\tSLUG\tNAME\tCATEGORY", err
+	case "offers":
+		offers, err := d.Offers()
+		for _, offer := range offers {
+			entries = append(entries, catalogEntry{ID: offer.Id, Slug: driver.OfferSlug(offer), CPU: offer.Cpu, RAM: offer.Ram, SSD: offer.Ssd, Traffic: offer.Traffic, Price: offer.Price})
+		}
+		return entries, "ID\tSLUG\tCPU\tRAM (MB)\tSSD (GB)\tTRAFFIC\tPRICE", err
+	case "datacenters":
+		datacenters, err := d.Datacenters()
+		for _, datacenter := range datacenters {
+			entries = append(entries, catalogEntry{ID: datacenter.Id, Slug: driver.Slugify(datacenter.Name), Name: datacenter.Name, Country: datacenter.Country, State: datacenter.State})
+		}
+		return entries, "ID\tSLUG\tNAME\tCOUNTRY\tSTATE", err
+	}
+	return nil, "", fmt.Errorf("Unknown catalog %s", kind)
+}
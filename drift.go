@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// drift reports the differences between the state of a machine and its VPS,
+// and fails when there are any so it can be used in monitoring checks. With
+// --reconcile it first repairs what it can.
+func drift(args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	reconcile := fs.Bool("reconcile", false, "Restore the hostname and record a changed IP address")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("Usage: drift [--reconcile] MACHINE")
+	}
+	name := fs.Arg(0)
+
+	d, err := loadMachine(name)
+	if err != nil {
+		return err
+	}
+	drifts, err := d.Drift()
+	if err != nil {
+		return err
+	}
+
+	if *reconcile && len(drifts) > 0 {
+		drifts, err = d.Reconcile(drifts)
+		if saveErr := saveMachine(name, d); saveErr != nil && err == nil {
+			err = saveErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, drift := range drifts {
+		fmt.Printf("%s\trecorded %q\tlive %q\n", drift.Field, drift.Recorded, drift.Live)
+	}
+	if len(drifts) > 0 {
+		return fmt.Errorf("Machine %s drifted from its VPSie VPS", name)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const apiURL = "https://api.vpsie.com/v1/"
+
+type tokenResponse struct {
+	Error     bool   `json:"error"`
+	ErrorCode string `json:"errorCode"`
+	Token     struct {
+		AccessToken string `json:"access_token"`
+	} `json:"token"`
+}
+
+// validateCredentials requests a token the same way go-vpsie does, but checks
+// the response since the client silently ignores authentication failures.
+func validateCredentials(clientID, clientSecret string) error {
+	data := url.Values{}
+	data.Add("grand_type", "bearer")
+	data.Add("client_id", clientID)
+	data.Add("client_secret", clientSecret)
+
+	res, err := http.PostForm(apiURL+"token", data)
+	if err != nil {
+		return fmt.Errorf("Error validating VPSie credentials: %s", err)
+	}
+	defer res.Body.Close()
+
+	out := tokenResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return fmt.Errorf("Error validating VPSie credentials: %s", err)
+	}
+
+	if out.Error {
+		return fmt.Errorf("VPSie rejected the client ID/secret: %s", out.ErrorCode)
+	}
+	if out.Token.AccessToken == "" {
+		return errors.New("VPSie did not return an access token, check the client ID/secret")
+	}
+	return nil
+}
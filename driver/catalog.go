@@ -0,0 +1,167 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/jdextraze/go-vpsie"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+const (
+	defaultCatalogTTL = 3600
+	cacheLockTimeout  = 30 * time.Second
+	cacheLockStaleAge = 30 * time.Second
+)
+
+type catalogCache struct {
+	FetchedAt time.Time
+	Items     json.RawMessage
+}
+
+func (d *Driver) images() ([]vpsie.Image, error) {
+	images := []vpsie.Image{}
+	err := d.loadCatalog("images", &images, func() (interface{}, error) {
+		return d.getClient().GetImages()
+	})
+	return images, err
+}
+
+func (d *Driver) datacenters() ([]vpsie.Datacenter, error) {
+	datacenters := []vpsie.Datacenter{}
+	err := d.loadCatalog("datacenters", &datacenters, func() (interface{}, error) {
+		return d.getClient().GetDatacenters()
+	})
+	return datacenters, err
+}
+
+// instances lists the VPSes of the account through the state cache. Root
+// passwords are never written to the cache.
+func (d *Driver) instances() ([]vpsie.VPSie, error) {
+	instances := []vpsie.VPSie{}
+	err := d.loadCached("instances", d.StateCacheTTL, false, &instances, func() (interface{}, error) {
+		listed, err := d.getClient().ListVPSie()
+		for i := range listed {
+			listed[i].Password = ""
+		}
+		return listed, err
+	})
+	return instances, err
+}
+
+func (d *Driver) offers() ([]vpsie.Offer, error) {
+	offers := []vpsie.Offer{}
+	err := d.loadCatalog("offers", &offers, func() (interface{}, error) {
+		return d.getClient().GetOffers()
+	})
+	return offers, err
+}
+
+// Images lists the VPSie images, through the catalog cache.
+func (d *Driver) Images() ([]vpsie.Image, error) {
+	return d.images()
+}
+
+// Offers lists the VPSie offers, through the catalog cache.
+func (d *Driver) Offers() ([]vpsie.Offer, error) {
+	return d.offers()
+}
+
+// Datacenters lists the VPSie datacenters, through the catalog cache.
+func (d *Driver) Datacenters() ([]vpsie.Datacenter, error) {
+	return d.datacenters()
+}
+
+// catalogTTL is the catalog TTL in seconds, 0 with --vpsie-no-cache.
+func (d *Driver) catalogTTL() int {
+	if d.NoCache {
+		return 0
+	}
+	return d.CatalogTTL
+}
+
+// loadCatalog reads a catalog from the store cache when it is younger than
+// the catalog TTL, and fetches and caches it otherwise.
+func (d *Driver) loadCatalog(name string, out interface{}, fetch func() (interface{}, error)) error {
+	return d.loadCached("catalog-"+name, d.catalogTTL(), d.RefreshCatalog, out, fetch)
+}
+
+// loadCached reads a list from the store cache when it is younger than ttl
+// seconds, and fetches and caches it otherwise. The fetch happens under a
+// lock, so concurrent plugin processes missing the cache make a single API
+// call and the others read its result.
+func (d *Driver) loadCached(name string, ttl int, refresh bool, out interface{}, fetch func() (interface{}, error)) error {
+	path := filepath.Join(d.sharedDir(), name+".json")
+
+	if ttl > 0 {
+		if !refresh && readCache(path, ttl, out) {
+			log.Debugf("Using cached VPSie %s", name)
+			return nil
+		}
+
+		unlock, err := lockFile(path+".lock", cacheLockTimeout, cacheLockStaleAge)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if !refresh && readCache(path, ttl, out) {
+			log.Debugf("Using VPSie %s cached by another process", name)
+			return nil
+		}
+	}
+
+	items, err := fetch()
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return err
+	}
+
+	// go-vpsie returns an empty list on API errors, which must not be cached.
+	if ttl > 0 && reflect.ValueOf(out).Elem().Len() > 0 {
+		if err := writeCatalogCache(path, raw); err != nil {
+			log.Debugf("Error caching VPSie %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func readCache(path string, ttl int, out interface{}) bool {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	cache := catalogCache{}
+	return json.Unmarshal(content, &cache) == nil &&
+		time.Since(cache.FetchedAt) < time.Duration(ttl)*time.Second &&
+		json.Unmarshal(cache.Items, out) == nil
+}
+
+func writeCatalogCache(path string, items json.RawMessage) error {
+	content, err := json.Marshal(catalogCache{FetchedAt: time.Now(), Items: items})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content)
+}
+
+// writeFileAtomic writes then renames so concurrent plugin processes never
+// read a partial file.
+func writeFileAtomic(path string, content []byte) error {
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,113 @@
+package driver
+
+import "github.com/jdextraze/go-vpsie"
+
+// apiClient is the part of the VPSie API the driver uses.
+type apiClient interface {
+	GetBalance() (vpsie.Balance, error)
+	GetProcessStatus(processId string) (vpsie.ProcessStatus, error)
+
+	GetOffers() ([]vpsie.Offer, error)
+	GetDatacenters() ([]vpsie.Datacenter, error)
+	GetImages() ([]vpsie.Image, error)
+
+	CreateVPSie(create vpsie.CreateVPSie) (vpsie.VPSie, error)
+	DeleteVPSie(id string) (string, error)
+	GetVPSie(id string) (vpsie.VPSie, error)
+	ListVPSie() ([]vpsie.VPSie, error)
+	StartVPSie(id string) (string, error)
+	ShutdownVPSie(id string) (vpsie.VPSieActionResponse, error)
+	RestartVPSie(id string) (string, error)
+	ForceRestartVPSie(id string) (string, error)
+	ChangeVPSieHostname(id string, hostname string) (vpsie.VPSieActionResponse, error)
+	ChangeVPSiePassword(id string) (vpsie.VPSiePasswordResponse, error)
+	SnapshotVPSie(id string, name string, note string) (vpsie.VPSieSnapshotResponse, error)
+	ResizeVPSie(id string, cpu string, ssd string, ram string) (vpsie.VPSieActionResponse, error)
+	VPSieStatistics(id string) (vpsie.VPSieStatisticsResponse, error)
+}
+
+// newAPIClient builds the clients of the driver. It can be replaced to run
+// the driver against another implementation of the API. The go-vpsie debug
+// output is left off, as it logs the root passwords the API returns; API
+// calls are traced with redaction by --vpsie-debug-api instead.
+var newAPIClient = func(clientID, clientSecret string) apiClient {
+	return vpsie.NewClient(clientID, clientSecret, false)
+}
+
+// unavailableClient fails every call with the error that kept the driver
+// from building a client, instead of calling the API without credentials.
+type unavailableClient struct {
+	err error
+}
+
+func (c unavailableClient) GetBalance() (vpsie.Balance, error) {
+	return vpsie.Balance{}, c.err
+}
+
+func (c unavailableClient) GetProcessStatus(processId string) (vpsie.ProcessStatus, error) {
+	return vpsie.ProcessStatus{}, c.err
+}
+
+func (c unavailableClient) GetOffers() ([]vpsie.Offer, error) {
+	return nil, c.err
+}
+
+func (c unavailableClient) GetDatacenters() ([]vpsie.Datacenter, error) {
+	return nil, c.err
+}
+
+func (c unavailableClient) GetImages() ([]vpsie.Image, error) {
+	return nil, c.err
+}
+
+func (c unavailableClient) CreateVPSie(create vpsie.CreateVPSie) (vpsie.VPSie, error) {
+	return vpsie.VPSie{}, c.err
+}
+
+func (c unavailableClient) DeleteVPSie(id string) (string, error) {
+	return "", c.err
+}
+
+func (c unavailableClient) GetVPSie(id string) (vpsie.VPSie, error) {
+	return vpsie.VPSie{}, c.err
+}
+
+func (c unavailableClient) ListVPSie() ([]vpsie.VPSie, error) {
+	return nil, c.err
+}
+
+func (c unavailableClient) StartVPSie(id string) (string, error) {
+	return "", c.err
+}
+
+func (c unavailableClient) ShutdownVPSie(id string) (vpsie.VPSieActionResponse, error) {
+	return vpsie.VPSieActionResponse{}, c.err
+}
+
+func (c unavailableClient) RestartVPSie(id string) (string, error) {
+	return "", c.err
+}
+
+func (c unavailableClient) ForceRestartVPSie(id string) (string, error) {
+	return "", c.err
+}
+
+func (c unavailableClient) ChangeVPSieHostname(id string, hostname string) (vpsie.VPSieActionResponse, error) {
+	return vpsie.VPSieActionResponse{}, c.err
+}
+
+func (c unavailableClient) ChangeVPSiePassword(id string) (vpsie.VPSiePasswordResponse, error) {
+	return vpsie.VPSiePasswordResponse{}, c.err
+}
+
+func (c unavailableClient) SnapshotVPSie(id string, name string, note string) (vpsie.VPSieSnapshotResponse, error) {
+	return vpsie.VPSieSnapshotResponse{}, c.err
+}
+
+func (c unavailableClient) ResizeVPSie(id string, cpu string, ssd string, ram string) (vpsie.VPSieActionResponse, error) {
+	return vpsie.VPSieActionResponse{}, c.err
+}
+
+func (c unavailableClient) VPSieStatistics(id string) (vpsie.VPSieStatisticsResponse, error) {
+	return vpsie.VPSieStatisticsResponse{}, c.err
+}
@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"github.com/docker/machine/libmachine/log"
+	"github.com/jdextraze/go-vpsie"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultCreateRetries = 3
+
+// createRetryDelay is the wait before the first create retry, doubled on
+// each retry.
+var createRetryDelay = 10 * time.Second
+
+// Words VPSie uses when a hypervisor has no room for the VPS.
+var transientCreateErrors = []string{
+	"capacity",
+	"hypervisor",
+	"no available",
+	"not enough",
+	"placement",
+	"resources",
+	"try again",
+}
+
+// createVPSie creates the VPS, retrying with backoff on transient capacity
+// errors and then trying each fallback datacenter in turn. A failed create
+// may still have happened, so the VPS is looked up before every retry.
+func (d *Driver) createVPSie(create vpsie.CreateVPSie) (vpsie.VPSie, error) {
+	datacenterIDs := append([]string{d.DatacenterID}, d.FallbackDatacenterIDs...)
+
+	var err error
+	tried := ""
+	for _, datacenterID := range datacenterIDs {
+		create.DatacenterId = datacenterID
+		delay := createRetryDelay
+
+		for attempt := 0; attempt <= d.CreateRetries; attempt++ {
+			if attempt > 0 {
+				log.Infof("Retrying VPSie create in datacenter %s in %s (attempt %d of %d)...", datacenterID, delay, attempt, d.CreateRetries)
+				time.Sleep(delay)
+				delay *= 2
+			}
+			if tried != "" {
+				if instance, found, err := d.findCreated(create.Hostname); err != nil {
+					return vpsie.VPSie{}, err
+				} else if found {
+					d.DatacenterID = tried
+					return instance, nil
+				}
+			}
+			tried = datacenterID
+
+			var instance vpsie.VPSie
+			instance, err = d.getClient().CreateVPSie(create)
+			if err == nil && instance.Id != "" {
+				d.DatacenterID = datacenterID
+				return instance, nil
+			}
+			if err == nil {
+				err = apiError("VPSie did not create the VPS")
+			}
+
+			if !isTransientCreateError(lastAPIResponseTo("POST", "vpsie")) {
+				return vpsie.VPSie{}, err
+			}
+			log.Warnf("Transient VPSie create error: %s", err)
+		}
+	}
+
+	return vpsie.VPSie{}, err
+}
+
+// findCreated looks for the VPS of a create that failed on the client side
+// but happened anyway, and adopts it.
+func (d *Driver) findCreated(hostname string) (vpsie.VPSie, bool, error) {
+	instances, err := d.getClient().ListVPSie()
+	if err != nil {
+		return vpsie.VPSie{}, false, err
+	}
+	for _, instance := range instances {
+		if instance.Name == hostname && parseNote(instance.Note)["machine-name"] == d.MachineName {
+			log.Infof("VPSie created VPS %s despite the error, using it", instance.Id)
+			adopted, err := d.adoptInstance(instance)
+			return adopted, true, err
+		}
+	}
+	return vpsie.VPSie{}, false, nil
+}
+
+func isTransientCreateError(last *apiResponse) bool {
+	if last == nil {
+		return false
+	}
+	if last.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+
+	body := strings.ToLower(last.Body)
+	for _, word := range transientCreateErrors {
+		if strings.Contains(body, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package driver
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// StateKeyEnv holds the key used to encrypt sensitive driver state.
+	StateKeyEnv = "VPSIE_STATE_KEY"
+
+	encryptedPrefix = "encrypted:"
+)
+
+func stateCipher() (cipher.AEAD, error) {
+	key := os.Getenv(StateKeyEnv)
+	if key == "" {
+		return nil, fmt.Errorf("%s must be set to use encrypted VPSie driver state", StateKeyEnv)
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptState seals a value stored in the machine store.
+func encryptState(value string) (string, error) {
+	gcm, err := stateCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptState opens a value sealed by encryptState. Values stored before
+// encryption was enabled are returned as is.
+func decryptState(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+
+	gcm, err := stateCipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("Encrypted VPSie driver state is too short")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("Error decrypting VPSie driver state, check %s: %s", StateKeyEnv, err)
+	}
+	return string(plain), nil
+}
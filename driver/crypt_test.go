@@ -0,0 +1,62 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptState(t *testing.T) {
+	t.Setenv(StateKeyEnv, "test key")
+
+	for _, value := range []string{"", "secret", "sécret\nwith lines"} {
+		sealed, err := encryptState(value)
+		if err != nil {
+			t.Fatalf("encryptState(%q) = %v", value, err)
+		}
+		if !strings.HasPrefix(sealed, encryptedPrefix) || (value != "" && strings.Contains(sealed, value)) {
+			t.Errorf("encryptState(%q) = %q, want a sealed value", value, sealed)
+		}
+		if opened, err := decryptState(sealed); err != nil || opened != value {
+			t.Errorf("decryptState(encryptState(%q)) = %q, %v", value, opened, err)
+		}
+	}
+
+	first, _ := encryptState("secret")
+	second, _ := encryptState("secret")
+	if first == second {
+		t.Error("encryptState() sealed the same value twice with the same nonce")
+	}
+}
+
+func TestDecryptState(t *testing.T) {
+	t.Setenv(StateKeyEnv, "test key")
+	sealed, err := encryptState("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "stored before encryption", key: "test key", value: "plain", want: "plain"},
+		{name: "sealed", key: "test key", value: sealed, want: "secret"},
+		{name: "wrong key", key: "other key", value: sealed, wantErr: true},
+		{name: "no key", value: sealed, wantErr: true},
+		{name: "truncated", key: "test key", value: encryptedPrefix + "AAAA", wantErr: true},
+		{name: "not base64", key: "test key", value: encryptedPrefix + "!", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(StateKeyEnv, test.key)
+			got, err := decryptState(test.value)
+			if (err != nil) != test.wantErr || got != test.want {
+				t.Errorf("decryptState(%q) = %q, %v, want %q, error %t", test.value, got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/jdextraze/go-vpsie"
+	"sort"
+	"strconv"
+)
+
+// Drift is a difference between the driver state and the VPS reported by
+// VPSie, usually left by a change made in the VPSie panel.
+type Drift struct {
+	Field    string
+	Recorded string
+	Live     string
+}
+
+// Drift compares the driver state with the live VPS.
+func (d *Driver) Drift() ([]Drift, error) {
+	instance, err := d.LiveInstance()
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := []Drift{}
+	check := func(field, recorded, live string) {
+		if recorded != live {
+			drifts = append(drifts, Drift{field, recorded, live})
+		}
+	}
+
+	if d.Hostname != "" {
+		check("hostname", d.Hostname, instance.Name)
+	}
+	check("ip-address", d.IPAddress, instance.IpV4)
+	if d.UsePrivateIP {
+		check("private-ip", d.PrivateIP, instance.PrivateIp)
+	}
+	if d.UseIPv6 {
+		check("ipv6-address", d.IPv6Address, instance.IpV6)
+	}
+
+	if offer, err := d.getOffer(); err != nil {
+		log.Debugf("Error getting offer for drift detection: %s", err)
+	} else {
+		check("cpu", strconv.Itoa(offer.Cpu), strconv.Itoa(instance.Cpu))
+		check("ram", strconv.Itoa(offer.Ram), strconv.Itoa(instance.Ram))
+		check("ssd", strconv.Itoa(offer.Ssd), strconv.Itoa(instance.Ssd))
+	}
+
+	// VPSes claimed from a pool keep the pool note.
+	note := parseNote(instance.Note)
+	if _, pooled := note["pool"]; !pooled {
+		metadata := d.metadata()
+		keys := make([]string, 0, len(metadata))
+		for key := range metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			check(fmt.Sprintf("note %s", key), metadata[key], note[key])
+		}
+	}
+
+	return drifts, nil
+}
+
+// Reconcile repairs the drifts VPSie allows to repair: the hostname is set
+// back on the VPS and changed IP addresses are recorded in the driver state,
+// which the caller must save. The other drifts are returned, since the VPSie
+// API cannot change notes and offer changes need a resize.
+func (d *Driver) Reconcile(drifts []Drift) ([]Drift, error) {
+	remaining := []Drift{}
+	for _, drift := range drifts {
+		switch drift.Field {
+		case "hostname":
+			log.Infof("Setting VPSie hostname back to %s...", drift.Recorded)
+			res, err := d.getClient().ChangeVPSieHostname(d.InstanceID, drift.Recorded)
+			if err != nil {
+				return remaining, err
+			} else if res.Error {
+				return remaining, apiError("VPSie hostname change failed: %s", res.ErrorCode)
+			}
+		case "ip-address":
+			log.Infof("Recording new IP address %s", drift.Live)
+			d.IPAddress = drift.Live
+		case "private-ip":
+			log.Infof("Recording new private IP address %s", drift.Live)
+			d.PrivateIP = drift.Live
+		case "ipv6-address":
+			log.Infof("Recording new IPv6 address %s", drift.Live)
+			d.IPv6Address = drift.Live
+		default:
+			remaining = append(remaining, drift)
+		}
+	}
+	return remaining, nil
+}
+
+// LiveInstance returns the machine VPS as reported by VPSie, without its
+// root password. VPSie reports a deleted VPS as an empty one.
+func (d *Driver) LiveInstance() (vpsie.VPSie, error) {
+	instance, err := d.getClient().GetVPSie(d.InstanceID)
+	if err != nil {
+		return vpsie.VPSie{}, err
+	} else if instance.Id == "" {
+		return vpsie.VPSie{}, fmt.Errorf("VPSie VPS %s not found", d.InstanceID)
+	}
+	instance.Password = ""
+	return instance, nil
+}
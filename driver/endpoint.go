@@ -0,0 +1,69 @@
+package driver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiBaseTransport is the transport API requests are sent with. Proxies set
+// in HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used as by http.DefaultTransport.
+func (d *Driver) apiBaseTransport() (http.RoundTripper, error) {
+	if !d.APIInsecure && d.APICACert == "" {
+		return http.DefaultTransport, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: d.APIInsecure}
+	if d.APICACert != "" {
+		var err error
+		if config.RootCAs, err = loadCACert(d.APICACert); err != nil {
+			return nil, err
+		}
+	}
+
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     config,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}, nil
+}
+
+func loadCACert(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading --vpsie-api-ca-cert: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificate found in --vpsie-api-ca-cert %s", path)
+	}
+	return pool, nil
+}
+
+// rewriteEndpoint sends a request go-vpsie made to the VPSie API to the
+// --vpsie-api-url endpoint instead.
+func rewriteEndpoint(req *http.Request, endpoint *url.URL) *http.Request {
+	api, _ := url.Parse(apiURL)
+	u := *req.URL
+	u.Scheme = endpoint.Scheme
+	u.Host = endpoint.Host
+	u.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + strings.TrimPrefix(req.URL.Path, api.Path)
+
+	rewritten := *req
+	rewritten.URL = &u
+	rewritten.Host = ""
+	return &rewritten
+}
+
+func validateAPIURL(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid --vpsie-api-url %q, expected an http or https URL", endpoint)
+	}
+	return nil
+}
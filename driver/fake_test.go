@@ -0,0 +1,245 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/mcnflag"
+	"github.com/jdextraze/go-vpsie"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// fakeClient is an in-memory VPSie account. Calls the tests do not expect
+// fail through the embedded unavailableClient.
+type fakeClient struct {
+	unavailableClient
+
+	mu        sync.Mutex
+	instances []vpsie.VPSie
+	nextID    int
+
+	images      []vpsie.Image
+	datacenters []vpsie.Datacenter
+	offers      []vpsie.Offer
+
+	// createFailures fail that many creates with the given response, and
+	// createdAnyway makes them create the VPS regardless, as a create timing
+	// out on the client side does.
+	createFailures int
+	createResponse apiResponse
+	createdAnyway  bool
+	creates        []vpsie.CreateVPSie
+
+	deleted           []string
+	passwordsChanged  []string
+	listErr, getErr   error
+	createdIPv4       string
+	createdStatus     string
+	createdPassword   string
+	changedPassword   string
+	unknownStatusCode int
+}
+
+func newFakeClient(instances ...vpsie.VPSie) *fakeClient {
+	return &fakeClient{
+		unavailableClient: unavailableClient{errors.New("not expected by the test")},
+		instances:         instances,
+		images:            []vpsie.Image{{Id: defaultImageID, Name: "Ubuntu 22.04 x64"}},
+		datacenters:       []vpsie.Datacenter{{Id: defaultDatacenterID, Name: "Montreal"}},
+		offers:            []vpsie.Offer{{Id: defaultOfferID, Cpu: 1, Ram: 2048, Ssd: 40, Price: 10}},
+		createdIPv4:       "203.0.113.10",
+		createdStatus:     "Running",
+		createdPassword:   "created-password",
+		changedPassword:   "changed-password",
+		unknownStatusCode: http.StatusNotFound,
+	}
+}
+
+func (c *fakeClient) GetBalance() (vpsie.Balance, error) {
+	return vpsie.Balance{}, nil
+}
+
+func (c *fakeClient) GetImages() ([]vpsie.Image, error) {
+	return c.images, nil
+}
+
+func (c *fakeClient) GetDatacenters() ([]vpsie.Datacenter, error) {
+	return c.datacenters, nil
+}
+
+func (c *fakeClient) GetOffers() ([]vpsie.Offer, error) {
+	return c.offers, nil
+}
+
+func (c *fakeClient) ListVPSie() ([]vpsie.VPSie, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.listErr != nil {
+		return nil, c.listErr
+	}
+	return append([]vpsie.VPSie{}, c.instances...), nil
+}
+
+func (c *fakeClient) GetVPSie(id string) (vpsie.VPSie, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.getErr != nil {
+		return vpsie.VPSie{}, c.getErr
+	}
+	for _, instance := range c.instances {
+		if instance.Id == id {
+			return instance, nil
+		}
+	}
+	recordResponse("GET", "vpsie/"+id, c.unknownStatusCode, `{"error":true,"message":"VPSie not found"}`)
+	return vpsie.VPSie{}, nil
+}
+
+func (c *fakeClient) CreateVPSie(create vpsie.CreateVPSie) (vpsie.VPSie, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.creates = append(c.creates, create)
+
+	c.nextID++
+	instance := vpsie.VPSie{
+		Id:       fmt.Sprintf("vps-%d", c.nextID),
+		Name:     create.Hostname,
+		IpV4:     c.createdIPv4,
+		Status:   c.createdStatus,
+		Password: c.createdPassword,
+	}
+	if create.Note != nil {
+		instance.Note = *create.Note
+	}
+
+	if c.createFailures > 0 {
+		c.createFailures--
+		if c.createdAnyway {
+			c.instances = append(c.instances, instance)
+		}
+		recordResponse("POST", "vpsie", c.createResponse.StatusCode, c.createResponse.Body)
+		return vpsie.VPSie{}, nil
+	}
+	c.instances = append(c.instances, instance)
+	recordResponse("POST", "vpsie", http.StatusOK, `{"error":false}`)
+	return instance, nil
+}
+
+func (c *fakeClient) DeleteVPSie(id string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, instance := range c.instances {
+		if instance.Id == id {
+			c.instances = append(c.instances[:i], c.instances[i+1:]...)
+			c.deleted = append(c.deleted, id)
+			return "Deleted", nil
+		}
+	}
+	return "Not found", nil
+}
+
+func (c *fakeClient) ChangeVPSieHostname(id string, hostname string) (vpsie.VPSieActionResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.instances {
+		if c.instances[i].Id == id {
+			c.instances[i].Name = hostname
+			return vpsie.VPSieActionResponse{}, nil
+		}
+	}
+	return vpsie.VPSieActionResponse{}, fmt.Errorf("VPS %s not found", id)
+}
+
+func (c *fakeClient) ChangeVPSiePassword(id string) (vpsie.VPSiePasswordResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.passwordsChanged = append(c.passwordsChanged, id)
+	return vpsie.VPSiePasswordResponse{Password: c.changedPassword}, nil
+}
+
+// recordResponse makes the transport report a response for an API action,
+// as it does for the requests of the real client.
+func recordResponse(method, action string, statusCode int, body string) {
+	t, ok := http.DefaultClient.Transport.(*apiTransport)
+	if !ok {
+		t = &apiTransport{base: http.DefaultTransport}
+		http.DefaultClient.Transport = t
+	}
+	res := &apiResponse{Method: method, Path: "/v1/" + action, StatusCode: statusCode, Body: body}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = res
+	if t.responses == nil {
+		t.responses = map[string]*apiResponse{}
+	}
+	t.responses[method+" "+res.Path] = res
+}
+
+// newTestDriver returns a driver of machine test-machine in a temporary
+// store, using client for the API.
+func newTestDriver(t *testing.T, client apiClient) *Driver {
+	t.Setenv(credentialsFileEnv, filepath.Join(t.TempDir(), "credentials"))
+
+	storePath := t.TempDir()
+	d := NewDriver("test-machine", storePath)
+	for _, dir := range []string{d.ResolveStorePath("."), d.sharedDir()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.client = client
+	d.CreateTimeout = 1
+	d.PollInterval = 1
+	return d
+}
+
+// testOptions are the create flags with their default values, except for
+// the given ones.
+type testOptions map[string]interface{}
+
+func newTestOptions(d *Driver, values map[string]interface{}) testOptions {
+	o := testOptions{}
+	for _, f := range d.GetCreateFlags() {
+		switch f := f.(type) {
+		case mcnflag.StringFlag:
+			o[f.Name] = f.Value
+		case mcnflag.StringSliceFlag:
+			o[f.Name] = f.Value
+		case mcnflag.IntFlag:
+			o[f.Name] = f.Value
+		case mcnflag.BoolFlag:
+			o[f.Name] = false
+		}
+	}
+	for key, value := range values {
+		o[key] = value
+	}
+	return o
+}
+
+var _ drivers.DriverOptions = testOptions{}
+
+func (o testOptions) String(key string) string {
+	value, _ := o[key].(string)
+	return value
+}
+
+func (o testOptions) StringSlice(key string) []string {
+	value, _ := o[key].([]string)
+	return value
+}
+
+func (o testOptions) Int(key string) int {
+	value, _ := o[key].(int)
+	return value
+}
+
+func (o testOptions) Bool(key string) bool {
+	value, _ := o[key].(bool)
+	return value
+}
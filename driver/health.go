@@ -0,0 +1,97 @@
+package driver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CheckDockerHealth verifies the provisioned Docker daemon answers on its TLS
+// endpoint with the machine certificates and, when withSSH is set, that
+// docker info works on the machine. Each check is retried until it passes.
+func (d *Driver) CheckDockerHealth(withSSH bool, attempts int, interval time.Duration) error {
+	if err := retry(attempts, interval, d.pingDocker); err != nil {
+		return fmt.Errorf("Docker daemon is not responding over TLS: %s", err)
+	}
+	log.Info("Docker daemon responds over TLS")
+
+	if withSSH {
+		err := retry(attempts, interval, func() error {
+			_, err := drivers.RunSSHCommandFromDriver(d, "docker info")
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("docker info failed on the machine: %s", err)
+		}
+		log.Info("docker info succeeds on the machine")
+	}
+	return nil
+}
+
+func (d *Driver) pingDocker() error {
+	url, err := d.GetURL()
+	if err != nil {
+		return err
+	}
+
+	config, err := d.dockerTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: config},
+	}
+	res, err := client.Get(strings.Replace(url, "tcp://", "https://", 1) + "/_ping")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("/_ping returned %s", res.Status)
+	}
+	return nil
+}
+
+// dockerTLSConfig loads the client certificates docker-machine generated
+// for the machine.
+func (d *Driver) dockerTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(d.ResolveStorePath("cert.pem"), d.ResolveStorePath("key.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(d.ResolveStorePath("ca.pem"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}, nil
+}
+
+func retry(attempts int, interval time.Duration, f func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		log.Debugf("Attempt %d of %d failed: %s", i+1, attempts, err)
+		if i < attempts-1 {
+			time.Sleep(interval)
+		}
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const dnsHookTimeout = 30 * time.Second
+
+// dnsHookEvent is posted as JSON to a URL hook. A command hook receives the
+// same values as arguments (action, machine name, IP address) and in the
+// VPSIE_DNS_* environment variables.
+type dnsHookEvent struct {
+	Action    string `json:"action"`
+	Machine   string `json:"machine"`
+	Hostname  string `json:"hostname"`
+	IPAddress string `json:"ip_address"`
+}
+
+func isHookURL(hook string) bool {
+	return strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://")
+}
+
+func validateDNSHook(hook string) error {
+	if !isHookURL(hook) {
+		return nil
+	}
+	if _, err := url.Parse(hook); err != nil {
+		return fmt.Errorf("Invalid --vpsie-dns-hook URL %q: %s", hook, err)
+	}
+	return nil
+}
+
+// runDNSHook lets users keep records on external DNS providers in sync. A
+// failing hook is logged but never fails the machine operation.
+func (d *Driver) runDNSHook(action string) {
+	if d.DNSHook == "" {
+		return
+	}
+
+	event := dnsHookEvent{action, d.MachineName, d.Hostname, d.IPAddress}
+	log.Infof("Running DNS hook for %s of machine %s...", action, d.MachineName)
+
+	var err error
+	if isHookURL(d.DNSHook) {
+		err = postDNSHook(d.DNSHook, event)
+	} else {
+		err = execDNSHook(d.DNSHook, event)
+	}
+	if err != nil {
+		log.Warnf("DNS hook failed for %s of machine %s: %s", action, d.MachineName, err)
+	}
+}
+
+func postDNSHook(hook string, event dnsHookEvent) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: dnsHookTimeout}
+	res, err := client.Post(hook, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", hook, res.Status)
+	}
+	return nil
+}
+
+func execDNSHook(hook string, event dnsHookEvent) error {
+	cmd := exec.Command(hook, event.Action, event.Machine, event.IPAddress)
+	cmd.Env = append(os.Environ(),
+		"VPSIE_DNS_ACTION="+event.Action,
+		"VPSIE_DNS_MACHINE="+event.Machine,
+		"VPSIE_DNS_HOSTNAME="+event.Hostname,
+		"VPSIE_DNS_IP="+event.IPAddress,
+	)
+
+	done := make(chan error, 1)
+	output := &bytes.Buffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s: %s", err, strings.TrimSpace(output.String()))
+		}
+		return nil
+	case <-time.After(dnsHookTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("%s did not finish within %s", hook, dnsHookTimeout)
+	}
+}
@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"strings"
+)
+
+const maxHostnameLength = 63
+
+// sanitizeHostname maps a docker-machine name to a valid VPSie hostname:
+// lowercase letters, digits and dashes, not starting or ending with a dash.
+func sanitizeHostname(name string) string {
+	hostname := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+
+	if len(hostname) > maxHostnameLength {
+		hostname = hostname[:maxHostnameLength]
+	}
+	return strings.Trim(hostname, "-")
+}
+
+// Values of --vpsie-name-conflict.
+const (
+	nameConflictFail   = "fail"
+	nameConflictSuffix = "suffix"
+)
+
+const maxHostnameSuffix = 100
+
+// resolveHostnameConflict checks the hostname is not used by another VPS of
+// the account and, with the suffix strategy, appends the first free -N
+// suffix to it. With --vpsie-reuse-existing, a VPS left by an earlier create
+// of the same machine is adopted instead.
+func (d *Driver) resolveHostnameConflict() error {
+	d.reuse = nil
+	instances, err := d.getClient().ListVPSie()
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, instance := range instances {
+		used[instance.Name] = true
+	}
+
+	if !used[d.Hostname] {
+		return nil
+	}
+	for i, instance := range instances {
+		if instance.Name == d.Hostname && d.ReuseExisting && parseNote(instance.Note)["machine-name"] == d.MachineName {
+			log.Infof("Reusing VPSie VPS %s created earlier for machine %s", instance.Id, d.MachineName)
+			d.reuse = &instances[i]
+			return nil
+		}
+	}
+	if d.NameConflict != nameConflictSuffix {
+		return fmt.Errorf("VPSie hostname %s is already used, use --vpsie-name-conflict=%s to add a suffix", d.Hostname, nameConflictSuffix)
+	}
+
+	for i := 2; i <= maxHostnameSuffix; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		base := d.Hostname
+		if len(base)+len(suffix) > maxHostnameLength {
+			base = strings.TrimRight(base[:maxHostnameLength-len(suffix)], "-")
+		}
+		if hostname := base + suffix; !used[hostname] {
+			log.Infof("VPSie hostname %s is already used, using %s", d.Hostname, hostname)
+			d.Hostname = hostname
+			return nil
+		}
+	}
+	return fmt.Errorf("No free VPSie hostname found for %s", d.Hostname)
+}
+
+func validateNameConflict(strategy string) error {
+	switch strategy {
+	case nameConflictFail, nameConflictSuffix:
+		return nil
+	}
+	return fmt.Errorf("Invalid --vpsie-name-conflict %q, expected %s or %s", strategy, nameConflictFail, nameConflictSuffix)
+}
+
+// isDNSName checks name is made of valid hostname labels.
+func isDNSName(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || sanitizeHostname(label) != strings.ToLower(label) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHostname(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"web-1", "web-1"},
+		{"Web_Server.prod", "web-server-prod"},
+		{"-edge-", "edge"},
+		{"__", ""},
+		{"", ""},
+		{"été", "t"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 63)},
+		{strings.Repeat("a", 62) + "_b", strings.Repeat("a", 62)},
+	}
+
+	for _, test := range tests {
+		if got := sanitizeHostname(test.name); got != test.want {
+			t.Errorf("sanitizeHostname(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
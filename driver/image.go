@@ -0,0 +1,78 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/jdextraze/go-vpsie"
+	"strings"
+)
+
+// Distributions with a libmachine provisioner.
+var supportedDistributions = []string{
+	"arch",
+	"centos",
+	"coreos",
+	"debian",
+	"fedora",
+	"opensuse",
+	"rancheros",
+	"redhat",
+	"rhel",
+	"sles",
+	"ubuntu",
+}
+
+// Operating systems libmachine cannot provision at all.
+var unsupportedDistributions = []string{
+	"freebsd",
+	"netbsd",
+	"openbsd",
+	"windows",
+}
+
+// Releases too old for the Docker versions installed by get.docker.com.
+var unsupportedReleases = []string{
+	"centos 5",
+	"centos 6",
+	"debian 6",
+	"debian 7",
+	"ubuntu 10.04",
+	"ubuntu 12.04",
+}
+
+func validateImageCompatibility(image vpsie.Image) error {
+	name := normalizeImageName(image.Name + " " + image.Category)
+
+	for _, distribution := range unsupportedDistributions {
+		if strings.Contains(name, distribution) {
+			return fmt.Errorf("Image %s (%s) is not supported by docker-machine provisioning, choose a Linux image among: %s",
+				image.Name,
+				image.Id,
+				strings.Join(supportedDistributions, ", "),
+			)
+		}
+	}
+
+	for _, release := range unsupportedReleases {
+		if strings.Contains(name, release) {
+			return fmt.Errorf("Image %s (%s) is too old for current Docker releases, choose a newer %s image",
+				image.Name,
+				image.Id,
+				strings.SplitN(release, " ", 2)[0],
+			)
+		}
+	}
+
+	for _, distribution := range supportedDistributions {
+		if strings.Contains(name, distribution) {
+			return nil
+		}
+	}
+
+	log.Warnf("Image %s (%s) is not a known docker-machine distribution, provisioning may fail", image.Name, image.Id)
+	return nil
+}
+
+func normalizeImageName(name string) string {
+	return strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToLower(name))
+}
@@ -0,0 +1,77 @@
+package driver
+
+import (
+	"github.com/docker/machine/libmachine/log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleInterrupts makes a SIGINT or SIGTERM received during Create leave a
+// record of the created VPS, or delete it with --vpsie-rollback-on-interrupt,
+// before exiting and releasing the machine lock with unlock. The returned
+// function stops the handling.
+func (d *Driver) handleInterrupts(unlock func()) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warnf("Received %s during create", sig)
+			d.cleanupInterruptedCreate()
+			unlock()
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func (d *Driver) cleanupInterruptedCreate() {
+	j, err := d.loadJournal()
+	if err != nil {
+		log.Info("No VPSie VPS was created")
+		return
+	}
+
+	if !d.RollbackOnInterrupt {
+		log.Warnf("VPSie VPS %s was created, run docker-machine start %s to finish or docker-machine rm %s to delete it", j.InstanceID, d.MachineName, d.MachineName)
+		return
+	}
+
+	d.deleteCreated(j.InstanceID)
+}
+
+// cleanupFailedCreate deletes the VPS of a create failing after it was
+// created, so it is not left billing, unless --vpsie-no-cleanup-on-failure
+// keeps it for debugging.
+func (d *Driver) cleanupFailedCreate(cause error) {
+	if d.NoCleanupOnFailure {
+		log.Warnf("VPSie VPS %s was kept, run docker-machine start %s to finish or docker-machine rm %s to delete it", d.InstanceID, d.MachineName, d.MachineName)
+		return
+	}
+
+	log.Warnf("Create failed, cleaning up: %s", cause)
+	d.runDNSHook("remove")
+	d.deleteCreated(d.InstanceID)
+}
+
+func (d *Driver) deleteCreated(instanceID string) {
+	log.Infof("Deleting VPSie VPS %s...", instanceID)
+	status, err := d.getClient().DeleteVPSie(instanceID)
+	if err != nil || status != "Deleted" {
+		if err == nil {
+			err = apiError("Invalid status %s after remove", status)
+		}
+		log.Errorf("Error deleting VPSie VPS %s, delete it from the VPSie panel: %s", instanceID, err)
+		return
+	}
+	d.forgetClaimed(instanceID)
+	d.clearJournal()
+}
@@ -0,0 +1,142 @@
+package driver
+
+import (
+	"encoding/json"
+	"github.com/docker/machine/libmachine/log"
+	"io/ioutil"
+	"os"
+)
+
+// Create steps recorded in the journal, in order.
+const (
+	stepInstanceCreated = "instance-created"
+	stepKeyInstalled    = "key-installed"
+	stepPasswordLocked  = "password-locked"
+	stepUserDataRun     = "userdata-run"
+	stepDiskChecked     = "disk-checked"
+)
+
+var createSteps = []string{stepInstanceCreated, stepKeyInstalled, stepPasswordLocked, stepUserDataRun, stepDiskChecked}
+
+// journal is written to the machine directory after each step of Create,
+// because docker-machine only saves the driver state once Create returns.
+// Start completes the remaining steps of an interrupted create and Remove
+// rolls it back. The root password is not kept, Start resets it through the
+// API when the key was not installed yet.
+type journal struct {
+	Operation   string
+	InstanceID  string
+	IPAddress   string
+	PrivateIP   string `json:",omitempty"`
+	IPv6Address string `json:",omitempty"`
+	Steps       []string
+}
+
+func (j *journal) done(step string) bool {
+	for _, s := range j.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *journal) complete() bool {
+	for _, step := range createSteps {
+		if !j.done(step) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Driver) journalPath() string {
+	return d.ResolveStorePath("vpsie-journal.json")
+}
+
+func (d *Driver) loadJournal() (*journal, error) {
+	content, err := ioutil.ReadFile(d.journalPath())
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{}
+	return j, json.Unmarshal(content, j)
+}
+
+func (d *Driver) saveJournal(j *journal) error {
+	content, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(d.journalPath(), content, 0600)
+}
+
+// recordStep appends step to the journal. Failing to write the journal only
+// loses crash recovery, so it is logged rather than failing the operation.
+func (d *Driver) recordStep(j *journal, step string) {
+	j.Steps = append(j.Steps, step)
+	if err := d.saveJournal(j); err != nil {
+		log.Warnf("Error writing VPSie journal: %s", err)
+	}
+}
+
+func (d *Driver) clearJournal() {
+	os.Remove(d.journalPath())
+}
+
+// resumeCreate completes the steps an interrupted create did not record.
+func (d *Driver) resumeCreate() error {
+	j, err := d.loadJournal()
+	if err != nil {
+		return nil
+	}
+
+	log.Infof("Resuming interrupted create of VPSie VPS %s...", j.InstanceID)
+	if d.InstanceID == "" {
+		d.InstanceID = j.InstanceID
+		d.IPAddress = j.IPAddress
+		d.PrivateIP = j.PrivateIP
+		d.IPv6Address = j.IPv6Address
+	}
+
+	if !j.done(stepKeyInstalled) {
+		res, err := d.getClient().ChangeVPSiePassword(j.InstanceID)
+		if err != nil {
+			return err
+		} else if res.Error || res.Password == "" {
+			return apiError("VPSie password change failed: %s", res.ErrorCode)
+		}
+		sshKey, err := d.publicKey()
+		if err != nil {
+			return err
+		}
+		if err := d.addSshKeyToServer(res.Password, sshKey, false); err != nil {
+			return err
+		}
+		d.recordStep(j, stepKeyInstalled)
+	}
+
+	if !j.done(stepPasswordLocked) {
+		if err := d.lockRootPassword(); err != nil {
+			return err
+		}
+		d.recordStep(j, stepPasswordLocked)
+	}
+
+	if !j.done(stepUserDataRun) {
+		if err := d.runUserData(); err != nil {
+			return err
+		}
+		d.recordStep(j, stepUserDataRun)
+	}
+
+	if !j.done(stepDiskChecked) {
+		if err := d.checkFreeDisk(); err != nil {
+			return err
+		}
+		d.recordStep(j, stepDiskChecked)
+	}
+
+	d.clearJournal()
+	return nil
+}
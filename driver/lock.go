@@ -0,0 +1,123 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const lockRetryInterval = 100 * time.Millisecond
+
+// tryLock creates the lock file exclusively, which works across processes
+// on every platform docker-machine supports, and returns the token written
+// to it, or "" when the lock is held. Lock files not refreshed for staleAge
+// are left behind by killed processes and are removed.
+func tryLock(path string, staleAge time.Duration) (string, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err == nil {
+		token := strconv.Itoa(os.Getpid()) + " " + mcnutils.TruncateID(mcnutils.GenerateRandomID())
+		_, err = f.WriteString(token)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return token, nil
+	}
+	if !os.IsExist(err) {
+		return "", err
+	}
+
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleAge {
+		if content, err := ioutil.ReadFile(path); err == nil {
+			unlockFile(path, string(content))
+		}
+	}
+	return "", nil
+}
+
+// unlockFile removes a lock only while it still holds token, so a process
+// whose stale lock was taken over does not release the new owner's lock.
+func unlockFile(path, token string) {
+	if content, err := ioutil.ReadFile(path); err == nil && string(content) == token {
+		os.Remove(path)
+	}
+}
+
+// holdLock refreshes the lock file while the lock is held, so operations
+// outlasting staleAge are not taken over, and returns its release function.
+func holdLock(path, token string, staleAge time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(staleAge / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if content, err := ioutil.ReadFile(path); err == nil && string(content) == token {
+					now := time.Now()
+					os.Chtimes(path, now, now)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			unlockFile(path, token)
+		})
+	}
+}
+
+// lockFile waits up to timeout for the lock and returns its release function.
+func lockFile(path string, timeout, staleAge time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		token, err := tryLock(path, staleAge)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			return holdLock(path, token, staleAge), nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Timed out waiting for lock %s", path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+const (
+	machineLockTimeout  = 10 * time.Minute
+	machineLockStaleAge = 30 * time.Minute
+)
+
+func (d *Driver) machineLockPath() string {
+	return d.ResolveStorePath("vpsie.lock")
+}
+
+// lockMachine serializes the actions changing the VPS of this machine, so an
+// autoscaler and a user running docker-machine don't issue conflicting
+// VPSie actions. The state of a locked machine is never read from the
+// state cache, as the action waits for it to change.
+func (d *Driver) lockMachine() (func(), error) {
+	unlock, err := lockFile(d.machineLockPath(), machineLockTimeout, machineLockStaleAge)
+	if err != nil {
+		return nil, fmt.Errorf("Another operation is in progress on machine %s: %s", d.MachineName, err)
+	}
+	d.acting = true
+	return func() {
+		d.acting = false
+		unlock()
+	}, nil
+}
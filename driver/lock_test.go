@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	staleAge := 30 * time.Millisecond
+
+	unlock, err := lockFile(path, time.Second, staleAge)
+	if err != nil {
+		t.Fatalf("lockFile() = %v", err)
+	}
+	time.Sleep(4 * staleAge)
+	if token, err := tryLock(path, staleAge); err != nil || token != "" {
+		t.Fatalf("tryLock() = %q, %v on a held lock, want it refused", token, err)
+	}
+
+	// A lock taken over is not released by its previous owner.
+	if err := ioutil.WriteFile(path, []byte("other"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if content, err := ioutil.ReadFile(path); err != nil || string(content) != "other" {
+		t.Fatalf("unlock() released a lock taken over: %q, %v", content, err)
+	}
+
+	time.Sleep(2 * staleAge)
+	if token, err := tryLock(path, staleAge); err != nil || token != "" {
+		t.Fatalf("tryLock() = %q, %v, want the stale lock removed first", token, err)
+	}
+	if token, err := tryLock(path, staleAge); err != nil || token == "" {
+		t.Errorf("tryLock() = %q, %v after the stale lock was removed, want the lock", token, err)
+	}
+}
@@ -0,0 +1,163 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/jdextraze/go-vpsie"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManagedVPSie is a VPS created by this driver, recognized by the machine
+// name recorded in its note.
+type ManagedVPSie struct {
+	vpsie.VPSie
+	MachineName string
+}
+
+// ListManaged returns the VPSes of the account created by this driver for a
+// machine of this store. VPSes of other stores, such as of another
+// workstation or CI runner, are left out.
+func (d *Driver) ListManaged() ([]ManagedVPSie, error) {
+	storeID, err := d.storeID()
+	if err != nil {
+		return nil, err
+	}
+	instances, err := d.getClient().ListVPSie()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pooled VPSes belong to the store whose pool file records them.
+	managed := []ManagedVPSie{}
+	for _, instance := range instances {
+		note := parseNote(instance.Note)
+		if _, pooled := note["pool"]; !pooled && note["store-id"] != storeID {
+			continue
+		}
+		if name, _ := d.machineName(instance); name != "" {
+			managed = append(managed, ManagedVPSie{instance, name})
+		}
+	}
+	return managed, nil
+}
+
+// storeID returns the random ID of the docker-machine store, written to the
+// note of the VPSes created from it. The first process to need it creates it,
+// through a link so no other process can read it half written.
+func (d *Driver) storeID() (string, error) {
+	path := filepath.Join(d.sharedDir(), "store-id")
+	if content, err := ioutil.ReadFile(path); err == nil {
+		return strings.TrimSpace(string(content)), nil
+	}
+
+	if err := os.MkdirAll(d.sharedDir(), 0700); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(d.sharedDir(), "store-id")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(mcnutils.TruncateID(mcnutils.GenerateRandomID()))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Link(f.Name(), path); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// DeleteManaged deletes a VPS returned by ListManaged.
+func (d *Driver) DeleteManaged(instance ManagedVPSie) error {
+	status, err := d.getClient().DeleteVPSie(instance.Id)
+	if err != nil {
+		return err
+	} else if status != "Deleted" {
+		return apiError("Invalid status %s after remove", status)
+	}
+	return nil
+}
+
+// SnapshotRecord is a snapshot taken through the driver. The VPSie API
+// cannot list snapshots, so the driver state is the only record of them.
+type SnapshotRecord struct {
+	Name      string
+	Note      string
+	CreatedOn time.Time
+}
+
+// Snapshot takes a snapshot of the machine VPS and records it in the
+// driver state, which the caller must save.
+func (d *Driver) Snapshot(name, note string) error {
+	_, err := d.snapshot(name, note)
+	return err
+}
+
+func (d *Driver) snapshot(name, note string) (string, error) {
+	if _, ok := d.findSnapshot(name); ok {
+		return "", fmt.Errorf("Snapshot %s already exists for machine %s", name, d.MachineName)
+	}
+
+	res, err := d.getClient().SnapshotVPSie(d.InstanceID, name, note)
+	if err != nil {
+		return "", err
+	} else if res.Error {
+		return "", apiError("VPSie snapshot failed: %s", res.ErrorCode)
+	}
+
+	if res.SnaphotName != "" {
+		name = res.SnaphotName
+	}
+	d.Snapshots = append(d.Snapshots, SnapshotRecord{name, note, time.Now()})
+	return res.ProcessId, nil
+}
+
+// finalSnapshot takes the --vpsie-snapshot-on-remove snapshot and waits for
+// it, since deleting the VPS could interrupt it.
+func (d *Driver) finalSnapshot() error {
+	name := fmt.Sprintf("%s-final-%s", sanitizeHostname(d.MachineName), time.Now().UTC().Format("20060102-150405"))
+	log.Infof("Taking final snapshot %s of VPSie VPS %s...", name, d.InstanceID)
+	processID, err := d.snapshot(name, "Taken by docker-machine rm "+d.MachineName)
+	if err != nil {
+		return fmt.Errorf("Error taking final snapshot, the VPS was not removed: %s", err)
+	}
+	if err := d.waitForProcess(processID, d.createTimeout()); err != nil {
+		return fmt.Errorf("Error taking final snapshot, the VPS was not removed: %s", err)
+	}
+	return nil
+}
+
+// ForgetSnapshot removes a snapshot from the driver state. The VPSie API
+// cannot delete snapshots, so the snapshot itself is deleted from the VPSie
+// panel.
+func (d *Driver) ForgetSnapshot(name string) error {
+	i, ok := d.findSnapshot(name)
+	if !ok {
+		return fmt.Errorf("No snapshot %s recorded for machine %s", name, d.MachineName)
+	}
+	d.Snapshots = append(d.Snapshots[:i], d.Snapshots[i+1:]...)
+	return nil
+}
+
+func (d *Driver) findSnapshot(name string) (int, bool) {
+	for i, snapshot := range d.Snapshots {
+		if snapshot.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,143 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/jdextraze/go-vpsie"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The VPSie API has no tagging support, so driver metadata is stored as
+// key=value lines in the VPS note.
+const metadataSeparator = "\n"
+
+var weekdays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+func formatNote(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = key + "=" + metadata[key]
+	}
+	return strings.Join(lines, metadataSeparator)
+}
+
+func parseNote(note string) map[string]string {
+	metadata := map[string]string{}
+	for _, line := range strings.Split(note, metadataSeparator) {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 {
+			metadata[parts[0]] = parts[1]
+		}
+	}
+	return metadata
+}
+
+// validateTags checks tags fit the comma separated tags line of the note.
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, ",=\n") {
+			return fmt.Errorf("Invalid --vpsie-tag %q, tags cannot be empty or contain commas, equal signs or newlines", tag)
+		}
+	}
+	return nil
+}
+
+// validateNoteValue checks an option value written to the note cannot add or
+// rewrite other metadata lines, such as the machine-name ownership key.
+func validateNoteValue(option, value string) error {
+	if strings.ContainsAny(value, "=\r\n") {
+		return fmt.Errorf("Invalid --%s %q, it cannot contain equal signs or newlines", option, value)
+	}
+	return nil
+}
+
+// machineName returns the machine a VPS belongs to: the one its note names,
+// or for a VPS claimed from a pool of the store, the one the pool recorded.
+// It also tells whether the VPS records its machine at all.
+func (d *Driver) machineName(instance vpsie.VPSie) (string, bool) {
+	note := parseNote(instance.Note)
+	if name, ok := note["machine-name"]; ok {
+		return name, true
+	}
+	if pool, ok := note["pool"]; ok {
+		return d.claimedBy(pool, instance.Id)
+	}
+	return "", false
+}
+
+// verifyOwnership guards Remove against deleting a VPS the machine does not
+// manage, such as after its InstanceID was edited: the VPS must belong to the
+// machine, when it records one, and carry its tags. VPSes created before the
+// driver wrote notes have none and are accepted, as are pooled VPSes claimed
+// before pools recorded the claiming machine.
+func (d *Driver) verifyOwnership(instance vpsie.VPSie) error {
+	note := parseNote(instance.Note)
+	if name, ok := d.machineName(instance); ok && name == "" {
+		return fmt.Errorf("VPSie VPS %s is waiting in pool %s, refusing to delete it", instance.Id, note["pool"])
+	} else if ok && name != d.MachineName {
+		return fmt.Errorf("VPSie VPS %s belongs to machine %s, not %s, refusing to delete it", instance.Id, name, d.MachineName)
+	}
+
+	tags := map[string]bool{}
+	for _, tag := range strings.Split(note["tags"], ",") {
+		tags[tag] = true
+	}
+	for _, tag := range d.Tags {
+		if !tags[tag] {
+			return fmt.Errorf("VPSie VPS %s is not tagged %s, refusing to delete it", instance.Id, tag)
+		}
+	}
+	return nil
+}
+
+// validateAutoStop checks a window such as "mon-fri@19:00-07:00" or
+// "sat,sun@00:00-23:59". The day part is optional and defaults to every day.
+func validateAutoStop(window string) error {
+	times := window
+	if at := strings.Index(window, "@"); at >= 0 {
+		if err := validateDays(window[:at]); err != nil {
+			return err
+		}
+		times = window[at+1:]
+	}
+
+	parts := strings.Split(times, "-")
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid auto-stop window %q, expected [days@]HH:MM-HH:MM", window)
+	}
+	for _, part := range parts {
+		if _, err := time.Parse("15:04", part); err != nil {
+			return fmt.Errorf("Invalid auto-stop time %q in %q", part, window)
+		}
+	}
+	return nil
+}
+
+func validateDays(days string) error {
+	for _, group := range strings.Split(days, ",") {
+		for _, day := range strings.Split(group, "-") {
+			if !isWeekday(day) {
+				return fmt.Errorf("Invalid auto-stop day %q, expected one of %s", day, strings.Join(weekdays, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func isWeekday(day string) bool {
+	for _, weekday := range weekdays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNote(t *testing.T) {
+	tests := []struct {
+		note string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{"machine-name=web\nstore-id=abc", map[string]string{"machine-name": "web", "store-id": "abc"}},
+		{"machine-name=web\r\n tags=a,b \n", map[string]string{"machine-name": "web", "tags": "a,b"}},
+		{"free text\nexternal-id=x=y", map[string]string{"external-id": "x=y"}},
+	}
+
+	for _, test := range tests {
+		if got := parseNote(test.note); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseNote(%q) = %v, want %v", test.note, got, test.want)
+		}
+	}
+}
+
+func TestFormatNote(t *testing.T) {
+	metadata := map[string]string{"store-id": "abc", "machine-name": "web", "billing-tag": ""}
+	note := formatNote(metadata)
+	if note != "machine-name=web\nstore-id=abc" {
+		t.Errorf("formatNote(%v) = %q, want sorted lines without empty values", metadata, note)
+	}
+	delete(metadata, "billing-tag")
+	if parsed := parseNote(note); !reflect.DeepEqual(parsed, metadata) {
+		t.Errorf("parseNote(formatNote(%v)) = %v", metadata, parsed)
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		tags    []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"ci", "team-a"}, false},
+		{[]string{""}, true},
+		{[]string{"a,b"}, true},
+		{[]string{"a=b"}, true},
+		{[]string{"a\nmachine-name=other"}, true},
+	}
+
+	for _, test := range tests {
+		if err := validateTags(test.tags); (err != nil) != test.wantErr {
+			t.Errorf("validateTags(%q) = %v, want error %t", test.tags, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateNoteValue(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"", false},
+		{"cost-center 42", false},
+		{"a=b", true},
+		{"a\nmachine-name=other", true},
+		{"a\rb", true},
+	}
+
+	for _, test := range tests {
+		if err := validateNoteValue("vpsie-billing-tag", test.value); (err != nil) != test.wantErr {
+			t.Errorf("validateNoteValue(%q) = %v, want error %t", test.value, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// metrics are kept for the lifetime of the plugin process, which autoscalers
+// may keep around across many machines.
+type metrics struct {
+	mu            sync.Mutex
+	creates       int
+	createErrors  int
+	createSeconds float64
+	removes       int
+	removeErrors  int
+	apiRequests   int
+	apiErrors     int
+}
+
+var (
+	driverMetrics    = &metrics{}
+	serveMetricsOnce sync.Once
+)
+
+func (m *metrics) observeCreate(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.creates++
+	m.createSeconds += duration.Seconds()
+	if err != nil {
+		m.createErrors++
+	}
+}
+
+func (m *metrics) observeRemove(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removes++
+	if err != nil {
+		m.removeErrors++
+	}
+}
+
+func (m *metrics) observeAPI(failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apiRequests++
+	if failed {
+		m.apiErrors++
+	}
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# TYPE vpsie_creates_total counter")
+	fmt.Fprintf(w, "vpsie_creates_total %d\n", m.creates)
+	fmt.Fprintln(w, "# TYPE vpsie_create_errors_total counter")
+	fmt.Fprintf(w, "vpsie_create_errors_total %d\n", m.createErrors)
+	fmt.Fprintln(w, "# TYPE vpsie_create_duration_seconds summary")
+	fmt.Fprintf(w, "vpsie_create_duration_seconds_sum %f\n", m.createSeconds)
+	fmt.Fprintf(w, "vpsie_create_duration_seconds_count %d\n", m.creates)
+	fmt.Fprintln(w, "# TYPE vpsie_removes_total counter")
+	fmt.Fprintf(w, "vpsie_removes_total %d\n", m.removes)
+	fmt.Fprintln(w, "# TYPE vpsie_remove_errors_total counter")
+	fmt.Fprintf(w, "vpsie_remove_errors_total %d\n", m.removeErrors)
+	fmt.Fprintln(w, "# TYPE vpsie_api_requests_total counter")
+	fmt.Fprintf(w, "vpsie_api_requests_total %d\n", m.apiRequests)
+	fmt.Fprintln(w, "# TYPE vpsie_api_errors_total counter")
+	fmt.Fprintf(w, "vpsie_api_errors_total %d\n", m.apiErrors)
+}
+
+// validateMetricsAddr only accepts loopback addresses, the endpoint has no
+// authentication.
+func validateMetricsAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("Invalid metrics address %s: %s", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("Metrics address %s must be a loopback address", addr)
+	}
+	return nil
+}
+
+// serveMetrics starts the metrics endpoint once per plugin process.
+func (d *Driver) serveMetrics() {
+	if d.MetricsAddr == "" {
+		return
+	}
+
+	serveMetricsOnce.Do(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			driverMetrics.write(w)
+			d.writeMachineCount(w)
+		})
+
+		go func() {
+			if err := http.ListenAndServe(d.MetricsAddr, mux); err != nil {
+				log.Warnf("Error serving VPSie metrics on %s: %s", d.MetricsAddr, err)
+			}
+		}()
+	})
+}
+
+// machineCountTTL is how long the machine count is cached in the store, so
+// scrapes do not spend the API budget of the store on listing VPSes.
+const machineCountTTL = 60
+
+func (d *Driver) writeMachineCount(w io.Writer) {
+	ttl := machineCountTTL
+	if d.NoCache {
+		ttl = 0
+	}
+
+	// The count is cached as a single item list, as empty lists are not.
+	count := []int{}
+	err := d.loadCached("machine-count", ttl, false, &count, func() (interface{}, error) {
+		managed, err := d.ListManaged()
+		return []int{len(managed)}, err
+	})
+	if err != nil {
+		log.Debugf("Error listing VPSie machines for metrics: %s", err)
+		return
+	}
+
+	fmt.Fprintln(w, "# TYPE vpsie_machines gauge")
+	fmt.Fprintf(w, "vpsie_machines %d\n", count[0])
+}
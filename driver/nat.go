@@ -0,0 +1,64 @@
+package driver
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const dockerPort = 2376
+
+// natAddress returns the external host and port forwarded to a port of the
+// VPS by --vpsie-nat-map, for VPSes behind a NAT gateway.
+func (d *Driver) natAddress(port int) (string, int, bool) {
+	mappings, err := parseNATMap(d.NATMap, d.sshPort())
+	if err != nil {
+		return "", 0, false
+	}
+	address, ok := mappings[port]
+	if !ok {
+		return "", 0, false
+	}
+	host, externalPort, _ := net.SplitHostPort(address)
+	p, _ := strconv.Atoi(externalPort)
+	return host, p, true
+}
+
+// parseNATMap parses EXTERNAL_HOST:EXTERNAL_PORT=PORT mappings, keyed by the
+// port of the VPS, which is sshPort or the Docker port.
+func parseNATMap(entries []string, sshPort int) (map[int]string, error) {
+	mappings := map[int]string{}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid --vpsie-nat-map %q, expected EXTERNAL_HOST:EXTERNAL_PORT=PORT", entry)
+		}
+
+		port, err := strconv.Atoi(parts[1])
+		if err != nil || (port != sshPort && port != dockerPort) {
+			return nil, fmt.Errorf("Invalid --vpsie-nat-map %q, only ports %d and %d can be forwarded", entry, sshPort, dockerPort)
+		}
+		host, externalPort, err := net.SplitHostPort(parts[0])
+		if err != nil || host == "" {
+			return nil, fmt.Errorf("Invalid --vpsie-nat-map %q, expected EXTERNAL_HOST:EXTERNAL_PORT=PORT", entry)
+		}
+		if p, err := strconv.Atoi(externalPort); err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("Invalid --vpsie-nat-map %q, invalid external port %s", entry, externalPort)
+		}
+		if _, ok := mappings[port]; ok {
+			return nil, fmt.Errorf("VPSie driver accepts a single --vpsie-nat-map for port %d", port)
+		}
+		mappings[port] = parts[0]
+	}
+	return mappings, nil
+}
+
+// sshPort is the SSH port of the VPS, before any NAT mapping. Machines
+// created before --vpsie-ssh-port have no port recorded.
+func (d *Driver) sshPort() int {
+	if d.SSHPort == 0 {
+		return SSHPort
+	}
+	return d.SSHPort
+}
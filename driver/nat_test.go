@@ -0,0 +1,65 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNATMap(t *testing.T) {
+	tests := []struct {
+		entries []string
+		sshPort int
+		want    map[int]string
+		wantErr bool
+	}{
+		{entries: nil, sshPort: 22, want: map[int]string{}},
+		{entries: []string{"203.0.113.10:2201=22", "gw.example.com:2301=2376"}, sshPort: 22, want: map[int]string{22: "203.0.113.10:2201", 2376: "gw.example.com:2301"}},
+		{entries: []string{"[2001:db8::1]:2201=2222"}, sshPort: 2222, want: map[int]string{2222: "[2001:db8::1]:2201"}},
+		{entries: []string{"203.0.113.10:2201=22"}, sshPort: 2222, wantErr: true},
+		{entries: []string{"203.0.113.10:8080=80"}, sshPort: 22, wantErr: true},
+		{entries: []string{"203.0.113.10:2201"}, sshPort: 22, wantErr: true},
+		{entries: []string{"203.0.113.10=22"}, sshPort: 22, wantErr: true},
+		{entries: []string{":2201=22"}, sshPort: 22, wantErr: true},
+		{entries: []string{"203.0.113.10:70000=22"}, sshPort: 22, wantErr: true},
+		{entries: []string{"203.0.113.10:2201=22", "203.0.113.11:2201=22"}, sshPort: 22, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseNATMap(test.entries, test.sshPort)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseNATMap(%q, %d) = %v, want error %t", test.entries, test.sshPort, err, test.wantErr)
+		} else if err == nil && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseNATMap(%q, %d) = %v, want %v", test.entries, test.sshPort, got, test.want)
+		}
+	}
+}
+
+func TestNATSSHPort(t *testing.T) {
+	tests := []struct {
+		sshPort  int
+		natMap   []string
+		wantHost string
+		wantPort int
+	}{
+		{sshPort: 22, natMap: []string{"203.0.113.10:2201=22"}, wantHost: "203.0.113.10", wantPort: 2201},
+		{sshPort: 2222, natMap: []string{"203.0.113.10:2201=2222"}, wantHost: "203.0.113.10", wantPort: 2201},
+		{sshPort: 2222, natMap: []string{"203.0.113.10:2301=2376"}, wantHost: "203.0.113.10", wantPort: 2222},
+		{sshPort: 0, wantHost: "198.51.100.1", wantPort: 22},
+	}
+
+	for _, test := range tests {
+		d := NewDriver("test-machine", t.TempDir())
+		d.IPAddress = "198.51.100.1"
+		d.SSHPort = test.sshPort
+		d.NATMap = test.natMap
+
+		host, err := d.GetSSHHostname()
+		if err != nil || host != test.wantHost {
+			t.Errorf("GetSSHHostname() with port %d and %v = %q, %v, want %s", test.sshPort, test.natMap, host, err, test.wantHost)
+		}
+		port, err := d.GetSSHPort()
+		if err != nil || port != test.wantPort {
+			t.Errorf("GetSSHPort() with port %d and %v = %d, %v, want %d", test.sshPort, test.natMap, port, err, test.wantPort)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package driver
+
+import (
+	"github.com/docker/machine/libmachine/log"
+	"github.com/jdextraze/go-vpsie"
+	"strings"
+	"sync"
+)
+
+// errorList aggregates the errors of steps run in parallel.
+type errorList []error
+
+func (l errorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// parallel runs steps concurrently and returns all their errors.
+func parallel(steps ...func() error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(steps))
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step func() error) {
+			defer wg.Done()
+			errs[i] = step()
+		}(i, step)
+	}
+	wg.Wait()
+
+	failed := errorList{}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 1 {
+		return failed[0]
+	} else if len(failed) > 1 {
+		return failed
+	}
+	return nil
+}
+
+// prefetchCatalogs fills the catalog cache concurrently before the
+// validations read it. go-vpsie clients are not safe for concurrent use, so
+// each fetch gets its own client.
+func (d *Driver) prefetchCatalogs() {
+	if d.catalogTTL() <= 0 {
+		return
+	}
+
+	// The validations report why the client is unavailable.
+	if _, ok := d.getClient().(unavailableClient); ok {
+		return
+	}
+	clientID, clientSecret, err := d.credentials()
+	if err != nil {
+		return
+	}
+	newClient := func() apiClient {
+		return newAPIClient(clientID, clientSecret)
+	}
+
+	err = parallel(
+		func() error {
+			return d.loadCatalog("images", &[]vpsie.Image{}, func() (interface{}, error) {
+				return newClient().GetImages()
+			})
+		},
+		func() error {
+			return d.loadCatalog("datacenters", &[]vpsie.Datacenter{}, func() (interface{}, error) {
+				return newClient().GetDatacenters()
+			})
+		},
+		func() error {
+			return d.loadCatalog("offers", &[]vpsie.Offer{}, func() (interface{}, error) {
+				return newClient().GetOffers()
+			})
+		},
+	)
+	if err != nil {
+		log.Debugf("Error prefetching VPSie catalogs: %s", err)
+	}
+}
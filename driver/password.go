@@ -0,0 +1,34 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const disablePasswordAuthCommand = `sed -i 's/^#\?[[:space:]]*PasswordAuthentication.*/PasswordAuthentication no/' /etc/ssh/sshd_config && ` +
+	`(grep -q '^PasswordAuthentication no' /etc/ssh/sshd_config || echo 'PasswordAuthentication no' >> /etc/ssh/sshd_config) && ` +
+	`(systemctl reload sshd || systemctl reload ssh || service ssh reload || service sshd reload)`
+
+// lockRootPassword disables SSH password logins and rotates the root
+// password once the machine key is installed, so the password VPSie returned
+// at create, which ends up in the logs, is useless. The new password is not
+// kept; it can be reset from the VPSie panel.
+func (d *Driver) lockRootPassword() error {
+	if d.KeepPasswordAuth {
+		return nil
+	}
+
+	log.Info("Disabling SSH password authentication...")
+	if _, err := d.RunAsRoot(disablePasswordAuthCommand); err != nil {
+		return fmt.Errorf("Error disabling SSH password authentication: %s", err)
+	}
+
+	log.Info("Rotating the root password...")
+	res, err := d.getClient().ChangeVPSiePassword(d.InstanceID)
+	if err != nil {
+		return err
+	} else if res.Error {
+		return apiError("VPSie password change failed: %s", res.ErrorCode)
+	}
+	return nil
+}
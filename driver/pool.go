@@ -0,0 +1,336 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/jdextraze/go-vpsie"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	poolLockTimeout  = 30 * time.Second
+	poolLockStaleAge = 10 * time.Second
+
+	// poolReservationTTL frees the slot reserved by a pool fill that died
+	// while creating its VPS.
+	poolReservationTTL = time.Hour
+)
+
+// PooledVPSie is a VPS created ahead of time for a warm pool. Its root
+// password is not kept, the Create claiming it resets it.
+//
+// The pool file also holds the slots reserved by running fills, which have
+// a Reservation and no InstanceID yet, and the VPSes claimed by a machine,
+// which keep the pool note as the VPSie API cannot change notes and are
+// recognized by their MachineName.
+type PooledVPSie struct {
+	InstanceID   string
+	IPAddress    string
+	OfferID      string
+	ImageID      string
+	DatacenterID string
+	CreatedOn    time.Time
+	Reservation  string `json:",omitempty"`
+	MachineName  string `json:",omitempty"`
+}
+
+func (p PooledVPSie) waiting() bool {
+	return p.InstanceID != "" && p.MachineName == ""
+}
+
+func (d *Driver) poolPath(name string) string {
+	return filepath.Join(d.sharedDir(), "pool-"+name+".json")
+}
+
+// updatePool runs update on the pool content while holding the pool lock and
+// saves what it returns.
+func (d *Driver) updatePool(update func([]PooledVPSie) []PooledVPSie) error {
+	unlock, err := lockFile(filepath.Join(d.sharedDir(), "pool-"+d.Pool+".lock"), poolLockTimeout, poolLockStaleAge)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	pool, err := d.readPool(d.Pool)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(update(pool))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(d.poolPath(d.Pool), content, 0600)
+}
+
+func (d *Driver) readPool(name string) ([]PooledVPSie, error) {
+	pool := []PooledVPSie{}
+	content, err := ioutil.ReadFile(d.poolPath(name))
+	if os.IsNotExist(err) {
+		return pool, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return pool, json.Unmarshal(content, &pool)
+}
+
+// PooledInstances returns the VPSes waiting in the pool.
+func (d *Driver) PooledInstances() ([]PooledVPSie, error) {
+	pool, err := d.readPool(d.Pool)
+	if err != nil {
+		return nil, err
+	}
+	waiting := []PooledVPSie{}
+	for _, pooled := range pool {
+		if pooled.waiting() {
+			waiting = append(waiting, pooled)
+		}
+	}
+	return waiting, nil
+}
+
+// claimedBy returns the machine that claimed a VPS of a pool of the store,
+// since its note only names the pool, and whether the pool holds the VPS at
+// all. A VPS waiting in the pool is claimed by no machine.
+func (d *Driver) claimedBy(pool, instanceID string) (string, bool) {
+	if validatePool(pool, 0) != nil {
+		return "", false
+	}
+	instances, err := d.readPool(pool)
+	if err != nil {
+		log.Debugf("Error reading pool %s: %s", pool, err)
+		return "", false
+	}
+	for _, pooled := range instances {
+		if pooled.InstanceID == instanceID {
+			return pooled.MachineName, true
+		}
+	}
+	return "", false
+}
+
+// claimPooled takes a VPS of the machine offer, image and datacenter out of
+// the pool, if one is set, and records the machine claiming it.
+func (d *Driver) claimPooled() (PooledVPSie, bool) {
+	var claimed PooledVPSie
+	found := false
+	if d.Pool == "" {
+		return claimed, false
+	}
+
+	err := d.updatePool(func(pool []PooledVPSie) []PooledVPSie {
+		for i, pooled := range pool {
+			if pooled.waiting() && pooled.OfferID == d.OfferID && pooled.ImageID == d.ImageID && pooled.DatacenterID == d.DatacenterID {
+				claimed, found = pooled, true
+				pool[i].MachineName = d.MachineName
+				return pool
+			}
+		}
+		return pool
+	})
+	if err != nil {
+		log.Warnf("Error claiming a VPS from pool %s: %s", d.Pool, err)
+		return claimed, false
+	}
+	return claimed, found
+}
+
+// forgetClaimed drops a VPS claimed by the machine from the pool file once
+// it is deleted.
+func (d *Driver) forgetClaimed(instanceID string) {
+	if d.Pool == "" {
+		return
+	}
+	err := d.updatePool(func(pool []PooledVPSie) []PooledVPSie {
+		kept := []PooledVPSie{}
+		for _, pooled := range pool {
+			if pooled.InstanceID != instanceID {
+				kept = append(kept, pooled)
+			}
+		}
+		return kept
+	})
+	if err != nil {
+		log.Warnf("Error updating pool %s: %s", d.Pool, err)
+	}
+}
+
+// claimInstance turns a pooled VPS into the machine VPS, resetting its root
+// password to install the machine key. The pooled VPS keeps the pool note,
+// as the VPSie API cannot change notes.
+func (d *Driver) claimInstance(pooled PooledVPSie) (vpsie.VPSie, error) {
+	log.Infof("Claiming VPSie VPS %s from pool %s...", pooled.InstanceID, d.Pool)
+
+	res, err := d.getClient().ChangeVPSieHostname(pooled.InstanceID, d.Hostname)
+	if err != nil {
+		return vpsie.VPSie{}, err
+	} else if res.Error {
+		return vpsie.VPSie{}, apiError("VPSie hostname change failed: %s", res.ErrorCode)
+	}
+
+	instance, err := d.adoptInstance(vpsie.VPSie{Id: pooled.InstanceID})
+	if err != nil {
+		return vpsie.VPSie{}, err
+	}
+	if instance.IpV4 == "" {
+		instance.IpV4 = pooled.IPAddress
+	}
+	return instance, nil
+}
+
+// FillPool creates VPSes until the pool holds size of them and returns how
+// many were created. Each VPS slot is reserved under the pool lock first, so
+// fills running at the same time do not create more VPSes than missing.
+func (d *Driver) FillPool(size int) (int, error) {
+	created := 0
+	for {
+		reservation, err := d.reservePoolSlot(size)
+		if err != nil || reservation == "" {
+			return created, err
+		}
+
+		hostname := sanitizeHostname("pool-" + d.Pool + "-" + reservation)
+		note := formatNote(map[string]string{"pool": d.Pool})
+		instance, err := d.createVPSie(vpsie.CreateVPSie{
+			Hostname: hostname,
+			OfferId:  d.OfferID,
+			OsId:     d.ImageID,
+			Note:     &note,
+		})
+		if err != nil {
+			if err := d.releasePoolSlot(reservation, nil); err != nil {
+				log.Warnf("Error updating pool %s: %s", d.Pool, err)
+			}
+			return created, err
+		}
+
+		pooled := PooledVPSie{
+			InstanceID:   instance.Id,
+			IPAddress:    instance.IpV4,
+			OfferID:      d.OfferID,
+			ImageID:      d.ImageID,
+			DatacenterID: d.DatacenterID,
+			CreatedOn:    time.Now(),
+		}
+		if err := d.releasePoolSlot(reservation, &pooled); err != nil {
+			return created, err
+		}
+		log.Infof("Created VPSie VPS %s in pool %s", instance.Id, d.Pool)
+		created++
+	}
+}
+
+// reservePoolSlot reserves the slot of a VPS to create while the pool holds
+// fewer than size VPSes, waiting or being created, and returns "" otherwise.
+func (d *Driver) reservePoolSlot(size int) (string, error) {
+	reservation := ""
+	err := d.updatePool(func(pool []PooledVPSie) []PooledVPSie {
+		kept := []PooledVPSie{}
+		count := 0
+		for _, pooled := range pool {
+			if pooled.Reservation != "" && time.Since(pooled.CreatedOn) > poolReservationTTL {
+				continue
+			}
+			if pooled.MachineName == "" {
+				count++
+			}
+			kept = append(kept, pooled)
+		}
+		if count >= size {
+			return kept
+		}
+		reservation = mcnutils.TruncateID(mcnutils.GenerateRandomID())
+		return append(kept, PooledVPSie{
+			OfferID:      d.OfferID,
+			ImageID:      d.ImageID,
+			DatacenterID: d.DatacenterID,
+			CreatedOn:    time.Now(),
+			Reservation:  reservation,
+		})
+	})
+	return reservation, err
+}
+
+// releasePoolSlot replaces a reserved slot with the VPS created for it, or
+// frees it when pooled is nil.
+func (d *Driver) releasePoolSlot(reservation string, pooled *PooledVPSie) error {
+	return d.updatePool(func(pool []PooledVPSie) []PooledVPSie {
+		kept := []PooledVPSie{}
+		for _, p := range pool {
+			if p.Reservation != reservation {
+				kept = append(kept, p)
+			}
+		}
+		if pooled != nil {
+			kept = append(kept, *pooled)
+		}
+		return kept
+	})
+}
+
+// refillPool starts a detached pool fill command so the Create claiming a
+// pooled VPS does not wait for its replacement.
+func (d *Driver) refillPool() {
+	if d.PoolSize <= 0 {
+		return
+	}
+
+	clientID, clientSecret, err := d.credentials()
+	if err != nil {
+		log.Warnf("Error refilling pool %s: %s", d.Pool, err)
+		return
+	}
+	token, err := d.accessToken()
+	if err != nil {
+		log.Warnf("Error refilling pool %s: %s", d.Pool, err)
+		return
+	}
+	if token != "" {
+		clientID, clientSecret = "", ""
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		log.Warnf("Error refilling pool %s: %s", d.Pool, err)
+		return
+	}
+
+	cmd := exec.Command(executable, "pool", "fill",
+		"--vpsie-pool", d.Pool,
+		"--vpsie-pool-size", strconv.Itoa(d.PoolSize),
+		"--vpsie-offer-id", d.OfferID,
+		"--vpsie-image-id", d.ImageID,
+		"--vpsie-datacenter-id", d.DatacenterID,
+		"--vpsie-skip-validation",
+	)
+	cmd.Env = append(os.Environ(),
+		"MACHINE_STORAGE_PATH="+d.StorePath,
+		"VPSIE_CLIENT_ID="+clientID,
+		"VPSIE_CLIENT_SECRET="+clientSecret,
+		"VPSIE_CLIENT_SECRET_FILE=",
+		"VPSIE_ACCESS_TOKEN="+token,
+		"VPSIE_PROFILE=",
+		"VPSIE_VAULT_PATH=",
+	)
+	if err := cmd.Start(); err != nil {
+		log.Warnf("Error refilling pool %s: %s", d.Pool, err)
+		return
+	}
+	cmd.Process.Release()
+}
+
+func validatePool(pool string, size int) error {
+	if size > 0 && pool == "" {
+		return fmt.Errorf("VPSie driver requires the --vpsie-pool option with --vpsie-pool-size")
+	}
+	if pool != "" && sanitizeHostname(pool) != pool {
+		return fmt.Errorf("Invalid VPSie pool name %q, use lowercase letters, digits and dashes", pool)
+	}
+	return nil
+}
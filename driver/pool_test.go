@@ -0,0 +1,103 @@
+package driver
+
+import (
+	"github.com/jdextraze/go-vpsie"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFillPool(t *testing.T) {
+	client := newFakeClient()
+	defer func(newClient func(string, string) apiClient) { newAPIClient = newClient }(newAPIClient)
+	newAPIClient = func(string, string) apiClient { return client }
+
+	// As the pool fill command does.
+	d := newTestDriver(t, client)
+	d.MachineName = ""
+	options := newTestOptions(d, map[string]interface{}{
+		"vpsie-access-token": "token",
+		"vpsie-pool":         "ci",
+		"vpsie-pool-size":    2,
+	})
+	if err := d.SetConfigFromFlags(options); err != nil {
+		t.Fatalf("SetConfigFromFlags() = %v", err)
+	}
+	if err := d.PreCreateCheck(); err != nil {
+		t.Fatalf("PreCreateCheck() = %v", err)
+	}
+
+	created, err := d.FillPool(d.PoolSize)
+	if err != nil || created != 2 {
+		t.Fatalf("FillPool() = %d, %v, want 2 VPSes", created, err)
+	}
+	for _, create := range client.creates {
+		if !strings.HasPrefix(create.Hostname, "pool-ci-") {
+			t.Errorf("FillPool() created VPS %s, want a pool-ci- hostname", create.Hostname)
+		}
+	}
+	if created, err := d.FillPool(d.PoolSize); err != nil || created != 0 {
+		t.Errorf("FillPool() = %d, %v on a full pool, want no VPS", created, err)
+	}
+
+	pooled, err := d.PooledInstances()
+	if err != nil || len(pooled) != 2 {
+		t.Fatalf("PooledInstances() = %v, %v, want 2 VPSes", pooled, err)
+	}
+	if content, err := ioutil.ReadFile(d.poolPath("ci")); err != nil || strings.Contains(string(content), client.createdPassword) {
+		t.Errorf("pool file = %s, %v, want no root password", content, err)
+	}
+}
+
+func TestReservePoolSlot(t *testing.T) {
+	d := newTestDriver(t, newFakeClient())
+	d.Pool = "ci"
+
+	for i := 0; i < 2; i++ {
+		if reservation, err := d.reservePoolSlot(2); err != nil || reservation == "" {
+			t.Fatalf("reservePoolSlot() = %q, %v, want a reservation", reservation, err)
+		}
+	}
+	if reservation, err := d.reservePoolSlot(2); err != nil || reservation != "" {
+		t.Errorf("reservePoolSlot() = %q, %v on a full pool, want no reservation", reservation, err)
+	}
+}
+
+func TestPoolClaims(t *testing.T) {
+	client := newFakeClient(
+		vpsie.VPSie{Id: "vps-1", Note: "pool=ci"},
+		vpsie.VPSie{Id: "vps-2", Note: "pool=ci"},
+	)
+	d := newTestDriver(t, client)
+	d.Pool = "ci"
+	err := d.updatePool(func(pool []PooledVPSie) []PooledVPSie {
+		return append(pool, PooledVPSie{InstanceID: "vps-1", OfferID: d.OfferID, ImageID: d.ImageID, DatacenterID: d.DatacenterID}, PooledVPSie{InstanceID: "vps-2"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, ok := d.claimPooled()
+	if !ok || claimed.InstanceID != "vps-1" {
+		t.Fatalf("claimPooled() = %v, %t, want vps-1", claimed, ok)
+	}
+	if instance, err := d.claimInstance(claimed); err != nil || instance.Password != client.changedPassword {
+		t.Errorf("claimInstance() = %v, %v, want the reset root password", instance, err)
+	}
+	if name, _ := d.machineName(client.instances[0]); name != "test-machine" {
+		t.Errorf("claimed VPS belongs to %q, want test-machine", name)
+	}
+
+	d.InstanceID = "vps-2"
+	if err := d.Remove(); err == nil || !strings.Contains(err.Error(), "waiting in pool ci") {
+		t.Errorf("Remove() = %v, want a refusal to delete a waiting VPS", err)
+	}
+
+	d.InstanceID = "vps-1"
+	if err := d.Remove(); err != nil {
+		t.Fatalf("Remove() = %v", err)
+	}
+	if _, found := d.claimedBy("ci", "vps-1"); found {
+		t.Error("Remove() kept the claim of the deleted VPS in the pool")
+	}
+}
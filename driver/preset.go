@@ -0,0 +1,128 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/jdextraze/go-vpsie"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Preset selects an offer either by ID or by minimum resources, in which case
+// the cheapest matching offer is used.
+type Preset struct {
+	OfferID      string `json:"offer_id"`
+	ImageID      string `json:"image_id"`
+	DatacenterID string `json:"datacenter_id"`
+	CPU          int    `json:"cpu"`
+	RAM          int    `json:"ram"`
+	Disk         int    `json:"disk"`
+}
+
+var builtinPresets = map[string]Preset{
+	"small":     {CPU: 1, RAM: 1024, Disk: 20},
+	"medium":    {CPU: 2, RAM: 2048, Disk: 40},
+	"large":     {CPU: 4, RAM: 8192, Disk: 80},
+	"ci-runner": {CPU: 2, RAM: 4096, Disk: 40},
+}
+
+// loadPresets returns the built-in presets merged with the ones of the
+// presets file, which override built-ins of the same name.
+func loadPresets(path string) (map[string]Preset, error) {
+	presets := map[string]Preset{}
+	for name, preset := range builtinPresets {
+		presets[name] = preset
+	}
+	if path == "" {
+		return presets, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading VPSie presets file: %s", err)
+	}
+
+	custom := map[string]Preset{}
+	if err := json.Unmarshal(content, &custom); err != nil {
+		return nil, fmt.Errorf("Error parsing VPSie presets file: %s", err)
+	}
+	for name, preset := range custom {
+		presets[name] = preset
+	}
+	return presets, nil
+}
+
+func (d *Driver) getPreset() (Preset, error) {
+	presets, err := loadPresets(d.PresetsFile)
+	if err != nil {
+		return Preset{}, err
+	}
+
+	preset, ok := presets[d.Preset]
+	if !ok {
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Preset{}, fmt.Errorf("Unknown VPSie preset %s, available presets: %s", d.Preset, strings.Join(names, ", "))
+	}
+	return preset, nil
+}
+
+// applyPreset replaces the default IDs with the ones of the preset. IDs given
+// explicitly on the command line take precedence.
+func (d *Driver) applyPreset() error {
+	preset, err := d.getPreset()
+	if err != nil {
+		return err
+	}
+
+	if preset.ImageID != "" && d.ImageID == defaultImageID && d.Image == "" {
+		d.ImageID = preset.ImageID
+	}
+	if preset.DatacenterID != "" && d.DatacenterID == defaultDatacenterID && d.Datacenter == "" {
+		d.DatacenterID = preset.DatacenterID
+	}
+	if preset.OfferID != "" && d.OfferID == defaultOfferID && d.Offer == "" {
+		d.OfferID = preset.OfferID
+	}
+	return nil
+}
+
+// resolvePresetOffer picks the cheapest offer matching the preset resources
+// when neither the preset nor the command line selected an offer ID.
+func (d *Driver) resolvePresetOffer() error {
+	preset, err := d.getPreset()
+	if err != nil {
+		return err
+	}
+	if preset.OfferID != "" || d.OfferID != defaultOfferID {
+		return nil
+	}
+
+	offers, err := d.offers()
+	if err != nil {
+		return err
+	}
+
+	var cheapest *vpsie.Offer
+	for i, offer := range offers {
+		if offer.Cpu < preset.CPU || offer.Ram < preset.RAM || offer.Ssd < preset.Disk {
+			continue
+		}
+		if cheapest == nil || offer.Price < cheapest.Price {
+			cheapest = &offers[i]
+		}
+	}
+
+	if cheapest == nil {
+		return fmt.Errorf("No VPSie offer matches preset %s (%d vCPU, %d MB RAM, %d GB SSD)", d.Preset, preset.CPU, preset.RAM, preset.Disk)
+	}
+
+	d.OfferID = cheapest.Id
+	log.Infof("Using VPSie offer %s for preset %s", d.OfferID, d.Preset)
+	return nil
+}
@@ -0,0 +1,38 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"strings"
+	"time"
+)
+
+// waitForProcess polls a VPSie process, such as a snapshot or a resize,
+// until it finishes.
+func (d *Driver) waitForProcess(processID string, timeout time.Duration) error {
+	if processID == "" {
+		return nil
+	}
+
+	var failed error
+	err := d.waitFor(func() bool {
+		process, err := d.getClient().GetProcessStatus(processID)
+		if err != nil {
+			log.Debugf("Error getting VPSie process %s: %s", processID, err)
+			return false
+		}
+		status := strings.ToLower(process.Status)
+		switch {
+		case strings.Contains(status, "fail"), strings.Contains(status, "error"):
+			failed = fmt.Errorf("VPSie %s process %s failed: %s", process.Action, processID, process.Status)
+			return true
+		case process.Success, strings.Contains(status, "complete"), strings.Contains(status, "done"), strings.Contains(status, "finish"):
+			return true
+		}
+		return false
+	}, timeout)
+	if err != nil {
+		return fmt.Errorf("VPSie process %s did not finish within %s", processID, timeout)
+	}
+	return failed
+}
@@ -0,0 +1,74 @@
+package driver
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultProfile      = "default"
+	credentialsFileEnv  = "VPSIE_CREDENTIALS_FILE"
+	profileClientID     = "client_id"
+	profileClientSecret = "client_secret"
+	profileAccessToken  = "access_token"
+)
+
+// credentialsFile is ~/.vpsie/credentials unless VPSIE_CREDENTIALS_FILE is
+// set. It holds INI profiles such as:
+//
+//	[default]
+//	client_id = ...
+//	client_secret = ...
+func credentialsFile() string {
+	if path := os.Getenv(credentialsFileEnv); path != "" {
+		return path
+	}
+	return filepath.Join(mcnutils.GetHomeDir(), ".vpsie", "credentials")
+}
+
+// readProfile returns the keys of a profile of the credentials file. It is
+// read on every invocation, so the credentials never end up in the machine
+// store.
+func readProfile(name string) (map[string]string, error) {
+	path := credentialsFile()
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading VPSie credentials: %s", err)
+	}
+	defer file.Close()
+
+	profile := map[string]string(nil)
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == name && profile == nil {
+				profile = map[string]string{}
+			}
+		case section == name:
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) == 2 {
+				profile[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading VPSie credentials: %s", err)
+	}
+
+	if profile == nil {
+		return nil, fmt.Errorf("No profile %s in VPSie credentials file %s", name, path)
+	}
+	if profile[profileAccessToken] == "" && (profile[profileClientID] == "" || profile[profileClientSecret] == "") {
+		return nil, fmt.Errorf("Profile %s of %s must contain %s and %s, or %s", name, path, profileClientID, profileClientSecret, profileAccessToken)
+	}
+	return profile, nil
+}
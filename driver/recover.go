@@ -0,0 +1,96 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/jdextraze/go-vpsie"
+	"strings"
+)
+
+var errInstanceNotFound = errors.New("The VPSie VPS of the machine no longer exists")
+
+// ensureInstanceID rebinds a machine whose state lost its InstanceID, as
+// older driver versions or a corrupted config.json can leave behind, to the
+// VPS created for it. The VPS must carry the machine name in its note, or
+// have the machine hostname and an empty note.
+func (d *Driver) ensureInstanceID() error {
+	if d.InstanceID != "" {
+		return nil
+	}
+
+	matches, err := d.matchingInstances()
+	if err != nil {
+		return err
+	}
+
+	switch len(matches) {
+	case 0:
+		return errInstanceNotFound
+	case 1:
+	default:
+		return fmt.Errorf("%d VPSie VPS match machine %s, set the InstanceID in its config.json", len(matches), d.MachineName)
+	}
+
+	d.InstanceID = matches[0].Id
+	if d.IPAddress == "" {
+		d.IPAddress = matches[0].IpV4
+	}
+	if d.PrivateIP == "" {
+		d.PrivateIP = matches[0].PrivateIp
+	}
+	if d.IPv6Address == "" {
+		d.IPv6Address = matches[0].IpV6
+	}
+	log.Infof("Recovered VPSie VPS %s for machine %s", d.InstanceID, d.MachineName)
+	return nil
+}
+
+// matchingInstances lists the VPSes ensureInstanceID would rebind the
+// machine to.
+func (d *Driver) matchingInstances() ([]vpsie.VPSie, error) {
+	instances, err := d.getClient().ListVPSie()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []vpsie.VPSie{}
+	for _, instance := range instances {
+		if d.ownsInstance(instance) {
+			matches = append(matches, instance)
+		}
+	}
+	return matches, nil
+}
+
+func (d *Driver) ownsInstance(instance vpsie.VPSie) bool {
+	if strings.TrimSpace(instance.Note) != "" {
+		name, _ := d.machineName(instance)
+		return name == d.MachineName
+	}
+
+	hostname := d.Hostname
+	if hostname == "" {
+		hostname = sanitizeHostname(d.MachineName)
+	}
+	return hostname != "" && instance.Name == hostname
+}
+
+// adoptInstance takes over the VPS an interrupted or failed create of the
+// machine left behind. Its root password is unknown, so it is reset to
+// install the machine key.
+func (d *Driver) adoptInstance(instance vpsie.VPSie) (vpsie.VPSie, error) {
+	res, err := d.getClient().ChangeVPSiePassword(instance.Id)
+	if err != nil {
+		return vpsie.VPSie{}, err
+	} else if res.Error || res.Password == "" {
+		return vpsie.VPSie{}, apiError("VPSie password change failed: %s", res.ErrorCode)
+	}
+
+	adopted, err := d.getClient().GetVPSie(instance.Id)
+	if err != nil {
+		return vpsie.VPSie{}, err
+	}
+	adopted.Password = res.Password
+	return adopted, nil
+}
@@ -0,0 +1,76 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/jdextraze/go-vpsie"
+	"strconv"
+)
+
+// Resize moves the machine VPS to another offer, given by ID or name, and
+// records it in the driver state, which the caller must save. VPSie cannot
+// shrink disks, so the offer must have at least the current SSD.
+func (d *Driver) Resize(offerRef string) error {
+	unlock, err := d.lockMachine()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.ensureInstanceID(); err != nil {
+		return err
+	}
+
+	offer, err := d.findOffer(offerRef)
+	if err != nil {
+		return err
+	}
+	instance, err := d.getClient().GetVPSie(d.InstanceID)
+	if err != nil {
+		return err
+	}
+	if offer.Ssd < instance.Ssd {
+		return fmt.Errorf("VPSie offer %s has a %d GB SSD, smaller than the %d GB of the VPS", OfferSlug(offer), offer.Ssd, instance.Ssd)
+	}
+
+	log.Infof("Resizing VPSie VPS %s to %s...", d.InstanceID, OfferSlug(offer))
+	res, err := d.getClient().ResizeVPSie(d.InstanceID, strconv.Itoa(offer.Cpu), strconv.Itoa(offer.Ssd), strconv.Itoa(offer.Ram))
+	if err != nil {
+		return err
+	} else if res.Error {
+		return apiError("VPSie resize failed: %s", res.ErrorCode)
+	}
+	if err := d.waitForProcess(res.ProcessId, d.createTimeout()); err != nil {
+		return err
+	}
+
+	d.OfferID = offer.Id
+	d.Offer = ""
+	d.CPU, d.RAM, d.Disk, d.Traffic = offer.Cpu, offer.Ram, offer.Ssd, offer.Traffic
+	return nil
+}
+
+func (d *Driver) findOffer(ref string) (vpsie.Offer, error) {
+	offers, err := d.offers()
+	if err != nil {
+		return vpsie.Offer{}, err
+	}
+
+	candidates := make([]slugged, len(offers))
+	for i, offer := range offers {
+		if offer.Id == ref {
+			return offer, nil
+		}
+		candidates[i] = slugged{offer.Id, OfferSlug(offer)}
+	}
+	id, err := matchSlug("offer", ref, candidates)
+	if err != nil {
+		return vpsie.Offer{}, err
+	}
+	for _, offer := range offers {
+		if offer.Id == id {
+			return offer, nil
+		}
+	}
+	return vpsie.Offer{}, fmt.Errorf("Offer ID %s is invalid", id)
+}
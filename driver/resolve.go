@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/jdextraze/go-vpsie"
+	"strings"
+)
+
+type slugged struct {
+	id   string
+	slug string
+}
+
+// Slugify turns a catalog name such as "Ubuntu 16.04 x64" into the slug
+// "ubuntu-16-04-x64" accepted by the name options.
+func Slugify(name string) string {
+	slug := sanitizeHostname(name)
+	for strings.Contains(slug, "--") {
+		slug = strings.Replace(slug, "--", "-", -1)
+	}
+	return slug
+}
+
+// OfferSlug names an offer by its resources, RAM first, e.g. "2gb-1cpu-40gb".
+func OfferSlug(offer vpsie.Offer) string {
+	ram := fmt.Sprintf("%dmb", offer.Ram)
+	if offer.Ram%1024 == 0 {
+		ram = fmt.Sprintf("%dgb", offer.Ram/1024)
+	}
+	return fmt.Sprintf("%s-%dcpu-%dgb", ram, offer.Cpu, offer.Ssd)
+}
+
+// matchSlug returns the ID of the candidate whose slug is the query, or
+// starts with it when a single one does.
+func matchSlug(kind, query string, candidates []slugged) (string, error) {
+	query = Slugify(query)
+	prefixed := []slugged{}
+	for _, candidate := range candidates {
+		if candidate.slug == query {
+			return candidate.id, nil
+		}
+		if strings.HasPrefix(candidate.slug, query) {
+			prefixed = append(prefixed, candidate)
+		}
+	}
+	if len(prefixed) == 1 {
+		return prefixed[0].id, nil
+	}
+
+	choices := prefixed
+	if len(choices) == 0 {
+		choices = candidates
+	}
+	slugs := make([]string, len(choices))
+	for i, choice := range choices {
+		slugs[i] = choice.slug
+	}
+	if len(prefixed) > 1 {
+		return "", fmt.Errorf("VPSie %s %q is ambiguous, choose one of: %s", kind, query, strings.Join(slugs, ", "))
+	}
+	return "", fmt.Errorf("No VPSie %s matches %q, choose one of: %s", kind, query, strings.Join(slugs, ", "))
+}
+
+// resolveNames sets the image, datacenter and offer IDs selected by name.
+func (d *Driver) resolveNames() error {
+	if d.Image != "" {
+		images, err := d.images()
+		if err != nil {
+			return err
+		}
+		candidates := make([]slugged, len(images))
+		for i, image := range images {
+			candidates[i] = slugged{image.Id, Slugify(image.Name)}
+		}
+		if d.ImageID, err = matchSlug("image", d.Image, candidates); err != nil {
+			return err
+		}
+	}
+
+	if d.Datacenter != "" {
+		datacenters, err := d.datacenters()
+		if err != nil {
+			return err
+		}
+		candidates := make([]slugged, len(datacenters))
+		for i, datacenter := range datacenters {
+			candidates[i] = slugged{datacenter.Id, Slugify(datacenter.Name)}
+		}
+		if d.DatacenterID, err = matchSlug("datacenter", d.Datacenter, candidates); err != nil {
+			return err
+		}
+	}
+
+	if d.Offer != "" {
+		offers, err := d.offers()
+		if err != nil {
+			return err
+		}
+		candidates := make([]slugged, len(offers))
+		for i, offer := range offers {
+			candidates[i] = slugged{offer.Id, OfferSlug(offer)}
+		}
+		if d.OfferID, err = matchSlug("offer", d.Offer, candidates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"github.com/docker/machine/libmachine/log"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAPIRetries       = 3
+	defaultAPIRetryInterval = 2
+	maxAPIRetryDelay        = time.Minute
+)
+
+// send performs req, retrying transient failures with exponential backoff.
+// Rate limited requests were not processed and are always retried, while
+// network errors and server errors are only retried for requests that are
+// safe to repeat, as a create may have happened before the failure.
+func (t *apiTransport) send(req *http.Request) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		if t.budget != nil {
+			if err := t.budget.wait(); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		res, err := t.base.RoundTrip(req)
+		var body []byte
+		if err == nil {
+			body, err = ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+
+		if attempt >= t.retries || !retryable(req, res, err) {
+			if err != nil {
+				driverMetrics.observeAPI(true)
+				return nil, nil, err
+			}
+			return res, body, nil
+		}
+		driverMetrics.observeAPI(true)
+
+		delay := t.retryDelay(attempt, res)
+		if err != nil {
+			log.Debugf("VPSie API %s %s failed, retrying in %s: %s", req.Method, req.URL.Path, delay, err)
+		} else {
+			log.Debugf("VPSie API %s %s returned %d, retrying in %s", req.Method, req.URL.Path, res.StatusCode, delay)
+		}
+		time.Sleep(delay)
+
+		if req.GetBody != nil {
+			retry := *req
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, nil, err
+			}
+			req = &retry
+		}
+	}
+}
+
+func retryable(req *http.Request, res *http.Response, err error) bool {
+	if res != nil && res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if req.Method == "POST" && !isTokenRequest(req) {
+		return false
+	}
+	return err != nil || res.StatusCode >= http.StatusInternalServerError
+}
+
+// retryDelay doubles the retry interval on each attempt, unless the API
+// tells how long to wait in a Retry-After header.
+func (t *apiTransport) retryDelay(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	delay := t.retryInterval << uint(attempt)
+	if delay > maxAPIRetryDelay || delay <= 0 {
+		delay = maxAPIRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,84 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sshDialTimeout = 10 * time.Second
+
+// sshConnection is the root password authenticated connection used while
+// the machine key is installed. It is kept open across commands, as the
+// native client of libmachine dials twice for every command.
+type sshConnection struct {
+	password string
+	client   *gossh.Client
+}
+
+func (d *Driver) sshConnection(password string) (*gossh.Client, error) {
+	if d.sshConn != nil && d.sshConn.password == password {
+		return d.sshConn.client, nil
+	}
+	d.closeSshConnection()
+
+	address, err := d.GetSSHHostname()
+	if err != nil {
+		return nil, err
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return nil, err
+	}
+	config, err := ssh.NewNativeConfig(SSHUser, &ssh.Auth{Passwords: []string{password}})
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(strings.Trim(address, "[]"), strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, sshDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := gossh.NewClientConn(conn, addr, &config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	d.sshConn = &sshConnection{password, gossh.NewClient(c, chans, reqs)}
+	return d.sshConn.client, nil
+}
+
+func (d *Driver) closeSshConnection() {
+	if d.sshConn != nil {
+		d.sshConn.client.Close()
+		d.sshConn = nil
+	}
+}
+
+// runSshCommand runs cmd in a new session of the shared connection. A
+// failed session drops the connection so the next command dials again.
+func (d *Driver) runSshCommand(password string, cmd string) (string, error) {
+	client, err := d.sshConnection(password)
+	if err != nil {
+		return "", err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		d.closeSshConnection()
+		return "", fmt.Errorf("Error opening SSH session: %s", err)
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput(cmd)
+	log.Debugf("Ssh command output: %s", out)
+
+	return string(out), err
+}
@@ -0,0 +1,85 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"os"
+	"os/exec"
+)
+
+const (
+	// SSHKeyPassphraseEnv holds the machine key passphrase. It is read from the
+	// environment on each use so it is never written to the machine store.
+	SSHKeyPassphraseEnv = "VPSIE_SSH_KEY_PASSPHRASE"
+
+	// SSHAskPassEnv is set when the plugin binary is run by ssh-add as its
+	// SSH_ASKPASS program.
+	SSHAskPassEnv = "VPSIE_SSH_ASKPASS"
+)
+
+// generateEncryptedSSHKey writes a key pair like ssh.GenerateSSHKey, with the
+// private key in the OpenSSH format, encrypted by the passphrase through
+// bcrypt_pbkdf. The vendored x/crypto only writes legacy PEM encryption,
+// whose MD5 key derivation is easy to brute force, so ssh-keygen generates
+// the key.
+func generateEncryptedSSHKey(path string) error {
+	cmd, err := askPassCommand("ssh-keygen", "-q", "-o", "-t", "rsa", "-b", "2048", "-C", "", "-f", path)
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Error generating encrypted machine key: %s: %s", err, out)
+	}
+	return os.Chmod(path+".pub", 0600)
+}
+
+// addKeyToAgent loads an encrypted key into the running ssh-agent, which is
+// how libmachine's ssh client can use it.
+func addKeyToAgent(path string) error {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return fmt.Errorf("SSH_AUTH_SOCK must be set to use an encrypted machine key")
+	}
+
+	cmd, err := askPassCommand("ssh-add", path)
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Error adding machine key to ssh-agent: %s: %s", err, out)
+	}
+	return nil
+}
+
+// askPassCommand returns an OpenSSH command getting the machine key
+// passphrase by running this binary as its askpass program, so the
+// passphrase never appears in its arguments.
+func askPassCommand(name string, args ...string) (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(),
+		"SSH_ASKPASS="+executable,
+		"SSH_ASKPASS_REQUIRE=force",
+		"DISPLAY=none",
+		SSHAskPassEnv+"=1",
+	)
+	return cmd, nil
+}
+
+// copySSHKey copies an existing key pair into the machine directory, as
+// docker-machine expects the machine key at GetSSHKeyPath.
+func copySSHKey(src, dst string) error {
+	if err := mcnutils.CopyFile(src, dst); err != nil {
+		return fmt.Errorf("Error copying SSH key: %s", err)
+	}
+	if err := os.Chmod(dst, 0600); err != nil {
+		return err
+	}
+	if err := mcnutils.CopyFile(src+".pub", dst+".pub"); err != nil {
+		return fmt.Errorf("Error copying SSH public key: %s", err)
+	}
+	return nil
+}
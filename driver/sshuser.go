@@ -0,0 +1,80 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/docker/machine/libmachine/drivers"
+	"regexp"
+	"strings"
+)
+
+// copyChunkSize keeps the commands of copyAsRoot well below the 128 KiB
+// Linux allows a single argument, such as the command of sh -c.
+const copyChunkSize = 32 * 1024
+
+var sshUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+func validateSSHUser(user string) error {
+	if !sshUserPattern.MatchString(user) {
+		return fmt.Errorf("Invalid --vpsie-ssh-user %q, expected a lowercase user name", user)
+	}
+	return nil
+}
+
+// authorizeKeyCommand installs sshKey for the machine user. The VPSie root
+// password only opens root sessions, so another user is created with
+// passwordless sudo, which docker-machine needs to provision Docker. The key
+// is sent base64 encoded, as key comments can hold any character.
+func (d *Driver) authorizeKeyCommand(sshKey []byte) string {
+	if !bytes.HasSuffix(sshKey, []byte("\n")) {
+		sshKey = append(sshKey[:len(sshKey):len(sshKey)], '\n')
+	}
+	encoded := base64.StdEncoding.EncodeToString(sshKey)
+
+	user := d.GetSSHUsername()
+	if user == SSHUser {
+		return "mkdir -p ~/.ssh && echo " + encoded + " | base64 -d >> ~/.ssh/authorized_keys"
+	}
+	return fmt.Sprintf(
+		"(id -u %[1]s >/dev/null 2>&1 || useradd -m -s /bin/sh %[1]s) && "+
+			"mkdir -p ~%[1]s/.ssh && echo %[2]s | base64 -d >> ~%[1]s/.ssh/authorized_keys && chown -R %[1]s: ~%[1]s/.ssh && "+
+			"echo '%[1]s ALL=(ALL) NOPASSWD:ALL' > /etc/sudoers.d/%[1]s && chmod 440 /etc/sudoers.d/%[1]s",
+		user, encoded,
+	)
+}
+
+// asRoot wraps cmd in sudo when the machine user is not root.
+func (d *Driver) asRoot(cmd string) string {
+	if d.GetSSHUsername() == SSHUser {
+		return cmd
+	}
+	return "sudo sh -c '" + strings.Replace(cmd, "'", `'\''`, -1) + "'"
+}
+
+// RunAsRoot runs cmd as root over SSH with the machine key.
+func (d *Driver) RunAsRoot(cmd string) (string, error) {
+	return drivers.RunSSHCommandFromDriver(d, d.asRoot(cmd))
+}
+
+// copyAsRoot writes content to path on the machine as root. The SSH clients
+// of libmachine give commands no standard input, so content is sent base64
+// encoded, in commands of copyChunkSize bytes.
+func (d *Driver) copyAsRoot(content []byte, path string) error {
+	redirect := ">"
+	for {
+		chunk := content
+		if len(chunk) > copyChunkSize {
+			chunk = chunk[:copyChunkSize]
+		}
+		content = content[len(chunk):]
+
+		if _, err := d.RunAsRoot(fmt.Sprintf("echo %s | base64 -d %s %s", base64.StdEncoding.EncodeToString(chunk), redirect, path)); err != nil {
+			return err
+		}
+		if len(content) == 0 {
+			return nil
+		}
+		redirect = ">>"
+	}
+}
@@ -0,0 +1,38 @@
+package driver
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthorizeKeyCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	d := NewDriver("test-machine", t.TempDir())
+
+	keys := []string{
+		"ssh-rsa AAAAB3Nza machine",
+		"ssh-ed25519 AAAAC3Nza it's $(touch injected) `touch injected`\n",
+	}
+	for _, key := range keys {
+		cmd := exec.Command("sh", "-c", d.authorizeKeyCommand([]byte(key)))
+		cmd.Dir = home
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("authorizeKeyCommand(%q) failed: %s: %s", key, err, out)
+		}
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(home, ".ssh", "authorized_keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ssh-rsa AAAAB3Nza machine\nssh-ed25519 AAAAC3Nza it's $(touch injected) `touch injected`\n"
+	if string(content) != want {
+		t.Errorf("authorized_keys = %q, want %q", content, want)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(home, "injected")); len(matches) > 0 {
+		t.Error("authorizeKeyCommand() ran a command of the key comment")
+	}
+}
@@ -0,0 +1,97 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+const (
+	budgetWindow        = time.Minute
+	budgetLockTimeout   = 30 * time.Second
+	budgetLockStaleAge  = 10 * time.Second
+	createSlotStaleAge  = time.Hour
+	createSlotRetryWait = 5 * time.Second
+	createSlotTimeout   = 30 * time.Minute
+)
+
+// requestBudget limits the API requests made by every plugin process sharing
+// the same store to a number of requests per minute.
+type requestBudget struct {
+	dir       string
+	perMinute int
+}
+
+func (b *requestBudget) wait() error {
+	for {
+		delay, err := b.reserve()
+		if err != nil {
+			return err
+		}
+		if delay <= 0 {
+			return nil
+		}
+		log.Debugf("VPSie API request budget exhausted, waiting %s", delay)
+		time.Sleep(delay)
+	}
+}
+
+// reserve records a request if the budget allows it, otherwise it returns how
+// long to wait for the oldest request to leave the window.
+func (b *requestBudget) reserve() (time.Duration, error) {
+	unlock, err := lockFile(filepath.Join(b.dir, "api-requests.lock"), budgetLockTimeout, budgetLockStaleAge)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	path := filepath.Join(b.dir, "api-requests.json")
+	timestamps := []int64{}
+	if content, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(content, &timestamps)
+	}
+
+	now := time.Now()
+	recent := []int64{}
+	for _, timestamp := range timestamps {
+		if now.Sub(time.Unix(0, timestamp)) < budgetWindow {
+			recent = append(recent, timestamp)
+		}
+	}
+
+	if len(recent) >= b.perMinute {
+		return time.Unix(0, recent[0]).Add(budgetWindow).Sub(now), nil
+	}
+
+	content, err := json.Marshal(append(recent, now.UnixNano()))
+	if err != nil {
+		return 0, err
+	}
+	return 0, ioutil.WriteFile(path, content, 0600)
+}
+
+// acquireCreateSlot waits up to createSlotTimeout for one of max create
+// slots to be free and returns its release function.
+func acquireCreateSlot(dir string, max int) (func(), error) {
+	deadline := time.Now().Add(createSlotTimeout)
+	for {
+		for i := 0; i < max; i++ {
+			path := filepath.Join(dir, fmt.Sprintf("create-slot-%d.lock", i))
+			token, err := tryLock(path, createSlotStaleAge)
+			if err != nil {
+				return nil, err
+			}
+			if token != "" {
+				return holdLock(path, token, createSlotStaleAge), nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Timed out after %s waiting for one of %d concurrent VPSie creates to finish", createSlotTimeout, max)
+		}
+		log.Infof("Waiting for one of %d concurrent VPSie creates to finish...", max)
+		time.Sleep(createSlotRetryWait)
+	}
+}
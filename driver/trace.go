@@ -0,0 +1,115 @@
+package driver
+
+import (
+	"encoding/json"
+	"github.com/docker/machine/libmachine/log"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var secretFormKeys = regexp.MustCompile(`(?i)secret|password|token`)
+
+// apiTracer logs every VPSie API call for --vpsie-debug-api and appends it
+// to the --vpsie-api-trace file, as go-vpsie reports nothing of a failed
+// request but its error code.
+type apiTracer struct {
+	log  bool
+	path string
+
+	mu sync.Mutex
+}
+
+// apiTraceEntry is a line of the trace file.
+type apiTraceEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Request    string    `json:"request,omitempty"`
+	StatusCode int       `json:"status,omitempty"`
+	LatencyMS  int64     `json:"latency_ms"`
+	Response   string    `json:"response,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// record traces req, sent at start. Retries of the request are included in
+// its latency.
+func (t *apiTracer) record(req *http.Request, start time.Time, res *http.Response, body []byte, err error) {
+	entry := apiTraceEntry{
+		Time:      start.UTC(),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Request:   redactForm(req),
+		LatencyMS: int64(time.Since(start) / time.Millisecond),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.StatusCode = res.StatusCode
+		entry.Response = redactSecrets(string(body))
+	}
+
+	if t.log {
+		if err != nil {
+			log.Infof("VPSie API %s %s failed after %dms: %s", entry.Method, entry.Path, entry.LatencyMS, entry.Error)
+		} else {
+			log.Infof("VPSie API %s %s returned %d in %dms: %s", entry.Method, entry.Path, entry.StatusCode, entry.LatencyMS, entry.Response)
+		}
+		if entry.Request != "" {
+			log.Infof("VPSie API %s %s request: %s", entry.Method, entry.Path, entry.Request)
+		}
+	}
+	if t.path != "" {
+		if err := t.write(entry); err != nil {
+			log.Warnf("Error writing VPSie API trace %s: %s", t.path, err)
+		}
+	}
+}
+
+func (t *apiTracer) write(entry apiTraceEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// redactForm returns the form sent with req with the credentials redacted.
+func redactForm(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	form, err := ioutil.ReadAll(body)
+	if err != nil {
+		return ""
+	}
+
+	values, err := url.ParseQuery(string(form))
+	if err != nil {
+		return "<unreadable form>"
+	}
+	for key := range values {
+		if secretFormKeys.MatchString(key) {
+			values.Set(key, "redacted")
+		}
+	}
+	return values.Encode()
+}
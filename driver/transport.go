@@ -0,0 +1,194 @@
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var apiErrorBody = regexp.MustCompile(`"error"\s*:\s*true`)
+
+var secretFields = regexp.MustCompile(`("(?:password|access_token|refresh_token|client_secret)"\s*:\s*)"[^"]*"`)
+
+// apiTransport is installed on http.DefaultClient, which go-vpsie uses for
+// every request, so the driver can control API traffic without patching the
+// client.
+type apiTransport struct {
+	base          http.RoundTripper
+	budget        *requestBudget
+	tokens        *tokenCache
+	retries       int
+	retryInterval time.Duration
+	endpoint      *url.URL
+	accessToken   string
+	trace         *apiTracer
+
+	mu        sync.Mutex
+	last      *apiResponse
+	responses map[string]*apiResponse
+}
+
+// apiResponse keeps the last API payload, since go-vpsie only returns the
+// status or error code fields of a response.
+type apiResponse struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (t *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isAPIRequest(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	if t.accessToken != "" && isTokenRequest(req) {
+		return staticTokenResponse(req, t.accessToken)
+	}
+
+	tokenPath := ""
+	if t.tokens != nil && isTokenRequest(req) {
+		path, cached, err := t.tokens.lookup(req)
+		if err != nil {
+			return nil, err
+		} else if cached != nil {
+			return cached, nil
+		}
+		tokenPath = path
+	}
+
+	sent := req
+	if t.endpoint != nil {
+		sent = rewriteEndpoint(req, t.endpoint)
+	}
+	start := time.Now()
+	res, body, err := t.send(sent)
+	if t.trace != nil {
+		t.trace.record(sent, start, res, body, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	driverMetrics.observeAPI(res.StatusCode >= http.StatusBadRequest || apiErrorBody.Match(body))
+
+	if tokenPath != "" && res.StatusCode == http.StatusOK {
+		t.tokens.store(tokenPath, body)
+	}
+
+	t.mu.Lock()
+	t.last = &apiResponse{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		StatusCode: res.StatusCode,
+		Body:       redactSecrets(string(body)),
+	}
+	if t.responses == nil {
+		t.responses = map[string]*apiResponse{}
+	}
+	t.responses[req.Method+" "+req.URL.Path] = t.last
+	t.mu.Unlock()
+
+	return res, nil
+}
+
+func (t *apiTransport) lastResponse() *apiResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
+
+func (t *apiTransport) lastResponseTo(method, path string) *apiResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.responses[method+" "+path]
+}
+
+func redactSecrets(body string) string {
+	return secretFields.ReplaceAllString(body, `$1"<redacted>"`)
+}
+
+func lastAPIResponse() *apiResponse {
+	if t, ok := http.DefaultClient.Transport.(*apiTransport); ok {
+		return t.lastResponse()
+	}
+	return nil
+}
+
+// lastAPIResponseTo returns the last response to a request for an API
+// action, such as POST vpsie, unlike lastAPIResponse which may belong to a
+// request made concurrently.
+func lastAPIResponseTo(method, action string) *apiResponse {
+	t, ok := http.DefaultClient.Transport.(*apiTransport)
+	if !ok {
+		return nil
+	}
+	api, err := url.Parse(apiURL)
+	if err != nil {
+		return nil
+	}
+	return t.lastResponseTo(method, api.Path+action)
+}
+
+// apiError builds an error including the last VPSie API response payload.
+func apiError(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if last := lastAPIResponse(); last != nil {
+		msg += fmt.Sprintf(" (%s %s returned %d: %s)", last.Method, last.Path, last.StatusCode, last.Body)
+	}
+	return errors.New(msg)
+}
+
+var notFoundBody = regexp.MustCompile(`(?i)not\s*found|not\s*exist`)
+
+// isNotFoundResponse recognizes the response to a request for a VPS that
+// does not exist, which go-vpsie decodes into an empty VPSie.
+func isNotFoundResponse(res *apiResponse) bool {
+	return res != nil && (res.StatusCode == http.StatusNotFound || notFoundBody.MatchString(res.Body))
+}
+
+func isAPIRequest(req *http.Request) bool {
+	api, err := url.Parse(apiURL)
+	return err == nil && req.URL.Host == api.Host
+}
+
+func (d *Driver) installTransport() error {
+	if _, ok := http.DefaultClient.Transport.(*apiTransport); ok {
+		return nil
+	}
+
+	base, err := d.apiBaseTransport()
+	if err != nil {
+		return err
+	}
+	t := &apiTransport{
+		base:          base,
+		retries:       d.APIRetries,
+		retryInterval: time.Duration(d.APIRetryInterval) * time.Second,
+	}
+	if t.accessToken, err = d.accessToken(); err != nil {
+		return err
+	}
+	if d.APIURL != "" && d.APIURL != apiURL {
+		if t.endpoint, err = url.Parse(d.APIURL); err != nil {
+			return err
+		}
+	}
+	if d.APIBudget > 0 {
+		t.budget = &requestBudget{dir: d.sharedDir(), perMinute: d.APIBudget}
+	}
+	if d.CacheToken {
+		t.tokens = &tokenCache{dir: d.sharedDir(), endpoint: d.APIURL}
+	}
+	if d.DebugAPI || d.APITrace != "" {
+		t.trace = &apiTracer{log: d.DebugAPI, path: d.APITrace}
+	}
+	http.DefaultClient.Transport = t
+	return nil
+}
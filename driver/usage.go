@@ -0,0 +1,76 @@
+package driver
+
+// Usage is the disk and network usage of the machine VPS. The statistics
+// VPSie returns are samples of a recent period, from the first to the last
+// one, and not monthly totals, which the API does not report.
+type Usage struct {
+	From       string
+	To         string
+	Samples    int
+	NetIn      UsageSeries
+	NetOut     UsageSeries
+	DiskRead   UsageSeries
+	DiskWrite  UsageSeries
+	Disk       int
+	FreeDisk   int64
+	TrafficCap int
+}
+
+// UsageSeries summarizes a statistics series, in the unit VPSie reports its
+// samples in.
+type UsageSeries struct {
+	Latest  int64
+	Average int64
+}
+
+// Usage reads the VPS statistics and, with withSSH, the free disk space of
+// /var/lib/docker. FreeDisk is -1 when it was not read.
+func (d *Driver) Usage(withSSH bool) (Usage, error) {
+	usage := Usage{FreeDisk: -1}
+
+	instance, err := d.getClient().GetVPSie(d.InstanceID)
+	if err != nil {
+		return usage, err
+	}
+	usage.Disk = instance.Ssd
+
+	stats, err := d.getClient().VPSieStatistics(d.InstanceID)
+	if err != nil {
+		return usage, err
+	} else if stats.Error {
+		return usage, apiError("VPSie statistics failed: %s", stats.ErrorCode)
+	}
+
+	graph := stats.Graph
+	if len(graph.Time) > 0 {
+		usage.From = graph.Time[0]
+		usage.To = graph.Time[len(graph.Time)-1]
+	}
+	usage.Samples = len(graph.Time)
+	usage.NetIn = summarize(graph.NetIn)
+	usage.NetOut = summarize(graph.NetOut)
+	usage.DiskRead = summarize(graph.DiskRead)
+	usage.DiskWrite = summarize(graph.DiskWrite)
+
+	if offer, err := d.getOffer(); err == nil {
+		usage.TrafficCap = offer.Traffic
+	}
+
+	if withSSH {
+		if usage.FreeDisk, err = d.freeDisk(); err != nil {
+			return usage, err
+		}
+	}
+	return usage, nil
+}
+
+func summarize(samples []int64) UsageSeries {
+	if len(samples) == 0 {
+		return UsageSeries{}
+	}
+	total := int64(0)
+	for _, sample := range samples {
+		total += sample
+	}
+	return UsageSeries{Latest: samples[len(samples)-1], Average: total / int64(len(samples))}
+}
@@ -0,0 +1,20 @@
+package driver
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		samples []int64
+		want    UsageSeries
+	}{
+		{nil, UsageSeries{}},
+		{[]int64{5}, UsageSeries{Latest: 5, Average: 5}},
+		{[]int64{10, 20, 60, 10}, UsageSeries{Latest: 10, Average: 25}},
+	}
+
+	for _, test := range tests {
+		if got := summarize(test.samples); got != test.want {
+			t.Errorf("summarize(%v) = %+v, want %+v", test.samples, got, test.want)
+		}
+	}
+}
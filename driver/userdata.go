@@ -0,0 +1,48 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"io/ioutil"
+	"strings"
+)
+
+const userDataPath = "/tmp/vpsie-userdata"
+
+// validateUserData checks --vpsie-userdata is a script. The VPSie API has no
+// user data field, so it is run over SSH rather than by cloud-init, which
+// rules out #cloud-config files.
+func validateUserData(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Error reading --vpsie-userdata: %s", err)
+	}
+	if !strings.HasPrefix(string(content), "#!") {
+		return fmt.Errorf("--vpsie-userdata %s must be a script starting with #!, cloud-config is not supported", path)
+	}
+	return nil
+}
+
+// runUserData runs the --vpsie-userdata script as root once the machine key
+// is installed, before docker-machine provisions Docker.
+func (d *Driver) runUserData() error {
+	if d.UserDataFile == "" {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(d.UserDataFile)
+	if err != nil {
+		return fmt.Errorf("Error reading --vpsie-userdata: %s", err)
+	}
+
+	log.Infof("Running user data %s...", d.UserDataFile)
+	if err := d.copyAsRoot(content, userDataPath); err != nil {
+		return fmt.Errorf("Error copying user data %s: %s", d.UserDataFile, err)
+	}
+	out, err := d.RunAsRoot(fmt.Sprintf("chmod 700 %s && %s", userDataPath, userDataPath))
+	log.Debugf("User data output: %s", out)
+	if err != nil {
+		return fmt.Errorf("User data %s failed: %s", d.UserDataFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/machine/libmachine/log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// readVaultCredentials reads client_id and client_secret from a Vault path
+// using VAULT_ADDR and VAULT_TOKEN. Both KV v1 and v2 layouts are supported.
+func readVaultCredentials(path string) (string, string, error) {
+	secret := vaultSecret{}
+	if err := vaultRequest("GET", path, nil, &secret); err != nil {
+		return "", "", err
+	}
+
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	clientID, _ := data["client_id"].(string)
+	clientSecret, _ := data["client_secret"].(string)
+	if clientID == "" || clientSecret == "" {
+		return "", "", fmt.Errorf("Vault path %s must contain client_id and client_secret", path)
+	}
+
+	if secret.Renewable && secret.LeaseID != "" {
+		go renewVaultLease(secret.LeaseID, secret.LeaseDuration)
+	}
+
+	return clientID, clientSecret, nil
+}
+
+// renewVaultLease keeps a lease alive for as long as the plugin process runs,
+// renewing it when half of its duration has elapsed.
+func renewVaultLease(leaseID string, duration int) {
+	for duration > 0 {
+		time.Sleep(time.Duration(duration) * time.Second / 2)
+
+		renewed := vaultSecret{}
+		if err := vaultRequest("PUT", "sys/leases/renew", map[string]string{"lease_id": leaseID}, &renewed); err != nil {
+			log.Warnf("Error renewing Vault lease %s: %s", leaseID, err)
+			return
+		}
+		duration = renewed.LeaseDuration
+	}
+}
+
+func vaultRequest(method, path string, in interface{}, out *vaultSecret) error {
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return errors.New("VAULT_ADDR and VAULT_TOKEN must be set to use --vpsie-vault-path")
+	}
+
+	body := &bytes.Buffer{}
+	if in != nil {
+		if err := json.NewEncoder(body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("X-Vault-Token", token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error contacting Vault: %s", err)
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("Error decoding Vault response: %s", err)
+	}
+	if len(out.Errors) > 0 {
+		return fmt.Errorf("Vault error: %s", strings.Join(out.Errors, ", "))
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/docker/machine/libmachine/drivers"
@@ -11,294 +12,1948 @@ import (
 	"github.com/docker/machine/libmachine/state"
 	"github.com/jdextraze/go-vpsie"
 	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	defaultOfferID      = "9a0e49c6-9f22-11e3-8af5-005056aa8af7"
-	defaultDatacenterID = "55f06b85-c9ee-11e3-9845-005056aa8af7"
-	defaultImageID      = "75401d7d-d9d3-11e3-b135-005056aa8af7"
-	SSHUser             = "root"
-	SSHPort             = 22
+	defaultOfferID            = "9a0e49c6-9f22-11e3-8af5-005056aa8af7"
+	defaultDatacenterID       = "55f06b85-c9ee-11e3-9845-005056aa8af7"
+	defaultImageID            = "75401d7d-d9d3-11e3-b135-005056aa8af7"
+	defaultShutdownTimeout    = 120
+	autoscalerShutdownTimeout = 30
+	defaultMinCPU             = 1
+	defaultMinRAM             = 1024
+	defaultMinDisk            = 10
+	defaultMinFreeDisk        = 5
+	defaultCloudInitTimeout   = 600
+	defaultCreateTimeout      = 600
+	defaultPollInterval       = 3
+	SSHUser                   = "root"
+	SSHPort                   = 22
 )
 
 type Driver struct {
 	*drivers.BaseDriver
 	ClientId     string
 	ClientSecret string
+	AccessToken  string
+	Profile      string
+	VaultPath    string
+	EncryptState bool
 
 	ImageID      string
 	OfferID      string
 	DatacenterID string
+	Image        string
+	Offer        string
+	Datacenter   string
 
-	InstanceID string
+	FallbackDatacenterIDs []string
+	CreateRetries         int
 
-	client vpsie.Client
+	Preset      string
+	PresetsFile string
+
+	SkipValidation bool
+	CatalogTTL     int
+	RefreshCatalog bool
+	NoCache        bool
+
+	AllowTiny bool
+	MinCPU    int
+	MinRAM    int
+	MinDisk   int
+
+	MinFreeDisk int
+	Strict      bool
+
+	InstanceID    string
+	NATMap        []string
+	Tags          []string
+	URLHostname   string
+	Hostname      string
+	NameConflict  string
+	ReuseExisting bool
+	Snapshots     []SnapshotRecord
+
+	PrivateNetworking bool
+	UsePrivateIP      bool
+	IPv6              bool
+	UseIPv6           bool
+	Backups           bool
+
+	// Details of the VPS recorded at create for docker-machine inspect.
+	PrivateIP      string
+	IPv6Address    string
+	DatacenterName string
+	ImageName      string
+	CPU            int
+	RAM            int
+	Disk           int
+	Traffic        int
+	CreatedOn      time.Time
+
+	SSHAgent      bool
+	EncryptSSHKey bool
+	SSHKeyPath    string
+	UserDataFile  string
+
+	KeepPasswordAuth bool
+
+	ShutdownTimeout  int
+	CloudInitTimeout int
+	CreateTimeout    int
+	PollInterval     int
+	AutoStop         string
+	ExternalID       string
+	BillingTag       string
+	StoreID          string
+	Autoscaler       bool
+
+	MetricsAddr string
+
+	RollbackOnInterrupt bool
+	NoCleanupOnFailure  bool
+	SnapshotOnRemove    bool
+	StateCacheTTL       int
+	CacheToken          bool
+	DNSHook             string
+	Pool                string
+	PoolSize            int
+
+	APIURL               string
+	APIInsecure          bool
+	APICACert            string
+	DebugAPI             bool
+	APITrace             string
+	APIBudget            int
+	APIRetries           int
+	APIRetryInterval     int
+	MaxConcurrentCreates int
+	Runner               string
+	BillingAlert         int
+	MaxMonthlyPrice      int
+
+	client  apiClient
+	sshConn *sshConnection
+	acting  bool
+	reuse   *vpsie.VPSie
+}
+
+func NewDriver(hostName, storePath string) *Driver {
+	d := &Driver{
+		ImageID:          defaultImageID,
+		OfferID:          defaultOfferID,
+		DatacenterID:     defaultDatacenterID,
+		ShutdownTimeout:  defaultShutdownTimeout,
+		CreateRetries:    defaultCreateRetries,
+		APIRetries:       defaultAPIRetries,
+		APIRetryInterval: defaultAPIRetryInterval,
+		CatalogTTL:       defaultCatalogTTL,
+		MinCPU:           defaultMinCPU,
+		MinRAM:           defaultMinRAM,
+		MinDisk:          defaultMinDisk,
+		MinFreeDisk:      defaultMinFreeDisk,
+		CloudInitTimeout: defaultCloudInitTimeout,
+		CreateTimeout:    defaultCreateTimeout,
+		PollInterval:     defaultPollInterval,
+		BaseDriver: &drivers.BaseDriver{
+			MachineName: hostName,
+			StorePath:   storePath,
+			SSHUser:     SSHUser,
+			SSHPort:     SSHPort,
+		},
+	}
+	return d
+}
+
+func (d *Driver) GetCreateFlags() []mcnflag.Flag {
+	return []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_CLIENT_ID",
+			Name:   "vpsie-client-id",
+			Usage:  "VPSie Client ID",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_CLIENT_SECRET",
+			Name:   "vpsie-client-secret",
+			Usage:  "VPSie Client secret",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_CLIENT_SECRET_FILE",
+			Name:   "vpsie-client-secret-file",
+			Usage:  "Path to a file containing the VPSie Client secret",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_ACCESS_TOKEN",
+			Name:   "vpsie-access-token",
+			Usage:  "VPSie API access token, instead of a Client ID and secret",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_PROFILE",
+			Name:   "vpsie-profile",
+			Usage:  "Profile of ~/.vpsie/credentials used when no credentials are given (default: default)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_VAULT_PATH",
+			Name:   "vpsie-vault-path",
+			Usage:  "Vault path holding the VPSie client_id and client_secret (uses VAULT_ADDR and VAULT_TOKEN)",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_ENCRYPT_STATE",
+			Name:   "vpsie-encrypt-state",
+			Usage:  "Encrypt the VPSie client secret in the machine store with the key in " + StateKeyEnv,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_SSH_AGENT",
+			Name:   "vpsie-ssh-agent",
+			Usage:  "Authenticate with the keys of the running ssh-agent instead of generating a machine key",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_ENCRYPT_SSH_KEY",
+			Name:   "vpsie-encrypt-ssh-key",
+			Usage:  "Encrypt the machine key with the passphrase in " + SSHKeyPassphraseEnv + " and load it in ssh-agent",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_KEEP_PASSWORD_AUTH",
+			Name:   "vpsie-keep-password-auth",
+			Usage:  "Keep SSH password authentication and the root password VPSie set at create",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_USERDATA",
+			Name:   "vpsie-userdata",
+			Usage:  "Script run as root over SSH before Docker is provisioned",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_SSH_USER",
+			Name:   "vpsie-ssh-user",
+			Usage:  "SSH user, created with passwordless sudo when it is not root",
+			Value:  SSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_SSH_PORT",
+			Name:   "vpsie-ssh-port",
+			Usage:  "SSH port of the VPSie image",
+			Value:  SSHPort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_SSH_KEY_PATH",
+			Name:   "vpsie-ssh-key-path",
+			Usage:  "Existing private key used as the machine key instead of generating one",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_IMAGE_ID",
+			Name:   "vpsie-image-id",
+			Usage:  "VPSie Image ID",
+			Value:  defaultImageID,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_OFFER_ID",
+			Name:   "vpsie-offer-id",
+			Usage:  "VPSie Offer ID",
+			Value:  defaultOfferID,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_DATACENTER_ID",
+			Name:   "vpsie-datacenter-id",
+			Usage:  "VPSie Datacenter ID",
+			Value:  defaultDatacenterID,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_IMAGE",
+			Name:   "vpsie-image",
+			Usage:  "VPSie image name, e.g. ubuntu-16-04, instead of --vpsie-image-id",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_OFFER",
+			Name:   "vpsie-offer",
+			Usage:  "VPSie offer as RAM-CPU-SSD, e.g. 2gb-1cpu-40gb, instead of --vpsie-offer-id",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_DATACENTER",
+			Name:   "vpsie-datacenter",
+			Usage:  "VPSie datacenter name instead of --vpsie-datacenter-id",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "VPSIE_FALLBACK_DATACENTER_ID",
+			Name:   "vpsie-fallback-datacenter-id",
+			Usage:  "VPSie Datacenter ID to try when the main datacenter has no capacity (repeatable)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_CREATE_RETRIES",
+			Name:   "vpsie-create-retries",
+			Usage:  "Retries per datacenter when VPSie reports a transient capacity error",
+			Value:  defaultCreateRetries,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_PRESET",
+			Name:   "vpsie-preset",
+			Usage:  "VPSie size preset: small, medium, large, ci-runner or one of the presets file",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_PRESETS_FILE",
+			Name:   "vpsie-presets-file",
+			Usage:  "JSON file defining additional VPSie presets",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_SKIP_VALIDATION",
+			Name:   "vpsie-skip-validation",
+			Usage:  "Skip VPSie image, datacenter and offer validation when the IDs are known to be valid",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_CATALOG_TTL",
+			Name:   "vpsie-catalog-ttl",
+			Usage:  "Seconds the VPSie image, datacenter and offer catalogs are cached in the store (0 to disable)",
+			Value:  defaultCatalogTTL,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_REFRESH_CATALOG",
+			Name:   "vpsie-refresh-catalog",
+			Usage:  "Refetch the cached VPSie catalogs",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_NO_CACHE",
+			Name:   "vpsie-no-cache",
+			Usage:  "Always fetch the VPSie catalogs from the API, without reading or writing the store cache",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_ALLOW_TINY",
+			Name:   "vpsie-allow-tiny",
+			Usage:  "Allow VPSie offers below the minimum CPU, RAM and disk resources",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_MIN_CPU",
+			Name:   "vpsie-min-cpu",
+			Usage:  "VPSie minimum offer vCPU count",
+			Value:  defaultMinCPU,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_MIN_RAM",
+			Name:   "vpsie-min-ram",
+			Usage:  "VPSie minimum offer RAM in MB",
+			Value:  defaultMinRAM,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_MIN_DISK",
+			Name:   "vpsie-min-disk",
+			Usage:  "VPSie minimum offer disk in GB",
+			Value:  defaultMinDisk,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_MIN_FREE_DISK",
+			Name:   "vpsie-min-free-disk",
+			Usage:  "VPSie minimum free space in GB for /var/lib/docker after create",
+			Value:  defaultMinFreeDisk,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_STRICT",
+			Name:   "vpsie-strict",
+			Usage:  "Fail instead of warning when VPSie post-create checks do not pass",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_SHUTDOWN_TIMEOUT",
+			Name:   "vpsie-shutdown-timeout",
+			Usage:  "VPSie graceful shutdown timeout in seconds before forcing power off",
+			Value:  defaultShutdownTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_CLOUD_INIT_TIMEOUT",
+			Name:   "vpsie-cloud-init-timeout",
+			Usage:  "Seconds to wait for cloud-init to finish before provisioning (0 to skip)",
+			Value:  defaultCloudInitTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_CREATE_TIMEOUT",
+			Name:   "vpsie-create-timeout",
+			Usage:  "Seconds to wait for a new VPSie VPS to get an IP address, run and answer SSH",
+			Value:  defaultCreateTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_POLL_INTERVAL",
+			Name:   "vpsie-poll-interval",
+			Usage:  "Seconds between checks while waiting for a VPSie VPS",
+			Value:  defaultPollInterval,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_AUTO_STOP",
+			Name:   "vpsie-auto-stop",
+			Usage:  "VPSie auto-stop window recorded in the VPS note, e.g. mon-fri@19:00-07:00",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_EXTERNAL_ID",
+			Name:   "vpsie-external-id",
+			Usage:  "External ID recorded in the VPS note to correlate with other tooling",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_BILLING_TAG",
+			Name:   "vpsie-billing-tag",
+			Usage:  "Cost-center identifier recorded in the VPS note for invoicing",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_AUTOSCALER",
+			Name:   "vpsie-autoscaler",
+			Usage:  "Tune the VPSie driver for autoscalers such as gitlab-runner docker+machine",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_ROLLBACK_ON_INTERRUPT",
+			Name:   "vpsie-rollback-on-interrupt",
+			Usage:  "Delete the VPSie VPS when create is interrupted by SIGINT or SIGTERM",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_NO_CLEANUP_ON_FAILURE",
+			Name:   "vpsie-no-cleanup-on-failure",
+			Usage:  "Keep the VPSie VPS when create fails after creating it",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_SNAPSHOT_ON_REMOVE",
+			Name:   "vpsie-snapshot-on-remove",
+			Usage:  "Take a final snapshot of the VPSie VPS before removing it",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_STATE_CACHE_TTL",
+			Name:   "vpsie-state-cache-ttl",
+			Usage:  "Seconds the VPS list used for machine states is shared between plugin processes (0 to disable)",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_CACHE_TOKEN",
+			Name:   "vpsie-cache-token",
+			Usage:  "Share the VPSie access token between plugin processes until it expires",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "VPSIE_TAG",
+			Name:   "vpsie-tag",
+			Usage:  "Tag recorded in the VPSie VPS note and checked before removing it (repeatable)",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "VPSIE_NAT_MAP",
+			Name:   "vpsie-nat-map",
+			Usage:  "EXTERNAL_HOST:EXTERNAL_PORT=PORT forwarding the SSH port or 2376 of a VPSie VPS behind a NAT gateway",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_URL_HOSTNAME",
+			Name:   "vpsie-url-hostname",
+			Usage:  "DNS name used instead of the VPSie VPS IP address in the Docker URL, certificate and SSH connections",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_PRIVATE_NETWORKING",
+			Name:   "vpsie-private-networking",
+			Usage:  "Attach the VPSie VPS to the private network of its datacenter",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_USE_PRIVATE_IP",
+			Name:   "vpsie-use-private-ip",
+			Usage:  "Use the private IP address of the VPSie VPS in the Docker URL and SSH connections",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_IPV6",
+			Name:   "vpsie-ipv6",
+			Usage:  "Enable IPv6 on the VPSie VPS",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_USE_IPV6",
+			Name:   "vpsie-use-ipv6",
+			Usage:  "Use the IPv6 address of the VPSie VPS in the Docker URL and SSH connections",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_BACKUPS",
+			Name:   "vpsie-backups",
+			Usage:  "Enable automatic VPSie backups of the VPS",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_NAME_CONFLICT",
+			Name:   "vpsie-name-conflict",
+			Usage:  "What to do when the VPSie hostname is already used: fail or suffix",
+			Value:  nameConflictFail,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_REUSE_EXISTING",
+			Name:   "vpsie-reuse-existing",
+			Usage:  "Adopt the VPSie VPS an earlier create of the same machine left behind instead of failing",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_POOL",
+			Name:   "vpsie-pool",
+			Usage:  "Claim a ready VPSie VPS from this warm pool instead of creating one",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_POOL_SIZE",
+			Name:   "vpsie-pool-size",
+			Usage:  "Number of VPSie VPSes kept in the warm pool, refilled after each claim",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_DNS_HOOK",
+			Name:   "vpsie-dns-hook",
+			Usage:  "Command or URL called with the machine name and IP after create and before remove",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_METRICS_ADDR",
+			Name:   "vpsie-metrics-addr",
+			Usage:  "Loopback address serving Prometheus metrics while the plugin runs, e.g. 127.0.0.1:9190",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_API_URL",
+			Name:   "vpsie-api-url",
+			Usage:  "VPSie API endpoint, for staging or test environments",
+			Value:  apiURL,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_API_INSECURE",
+			Name:   "vpsie-api-insecure",
+			Usage:  "Do not verify the TLS certificate of the VPSie API",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_API_CA_CERT",
+			Name:   "vpsie-api-ca-cert",
+			Usage:  "PEM file of the CA certificates trusted for the VPSie API, e.g. of a TLS inspecting proxy",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "VPSIE_DEBUG_API",
+			Name:   "vpsie-debug-api",
+			Usage:  "Log every VPSie API request and response, with credentials redacted",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "VPSIE_API_TRACE",
+			Name:   "vpsie-api-trace",
+			Usage:  "File every VPSie API request and response is appended to as JSON lines, with credentials redacted",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_API_BUDGET",
+			Name:   "vpsie-api-budget",
+			Usage:  "Maximum VPSie API requests per minute shared by all machines of the store (0 for unlimited)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_API_RETRIES",
+			Name:   "vpsie-api-retries",
+			Usage:  "Retries of VPSie API requests failing with a rate limit, server or network error",
+			Value:  defaultAPIRetries,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_API_RETRY_INTERVAL",
+			Name:   "vpsie-api-retry-interval",
+			Usage:  "Seconds before the first retry of a VPSie API request, doubled on each retry",
+			Value:  defaultAPIRetryInterval,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_MAX_CONCURRENT_CREATES",
+			Name:   "vpsie-max-concurrent-creates",
+			Usage:  "Maximum VPSie machines created at the same time from the store (0 for unlimited)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_BILLING_ALERT",
+			Name:   "vpsie-billing-alert",
+			Usage:  "VPSie monthly charge above which Create warns about account usage (0 to disable)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "VPSIE_MAX_MONTHLY_PRICE",
+			Name:   "vpsie-max-monthly-price",
+			Usage:  "VPSie offer monthly price above which the machine is not created (0 for no limit)",
+		},
+	}
+}
+
+func (d *Driver) GetSSHHostname() (string, error) {
+	if host, _, ok := d.natAddress(d.sshPort()); ok {
+		return host, nil
+	}
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+	// libmachine joins the SSH host and port without brackets.
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]", nil
+	}
+	return ip, nil
+}
+
+func (d *Driver) GetSSHPort() (int, error) {
+	if _, port, ok := d.natAddress(d.sshPort()); ok {
+		return port, nil
+	}
+	return d.sshPort(), nil
+}
+
+func (d *Driver) DriverName() string {
+	return "vpsie"
+}
+
+func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	if err := d.LintFlags(flags); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(d.sharedDir(), 0700); err != nil {
+		return err
+	}
+	storeID, err := d.storeID()
+	if err != nil {
+		return err
+	}
+	d.StoreID = storeID
+	if err := d.installTransport(); err != nil {
+		return err
+	}
+
+	// Access tokens are only checked by the first API call.
+	token, err := d.accessToken()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		clientID, clientSecret, err := d.credentials()
+		if err != nil {
+			return err
+		}
+		if err := validateCredentials(clientID, clientSecret); err != nil {
+			return err
+		}
+	}
+
+	if d.EncryptState && d.ClientSecret != "" {
+		if d.ClientSecret, err = encryptState(d.ClientSecret); err != nil {
+			return err
+		}
+	}
+	if d.EncryptState && d.AccessToken != "" {
+		if d.AccessToken, err = encryptState(d.AccessToken); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LintFlags reads and validates the options without contacting VPSie or
+// reading stdin, so machine definitions can be checked offline.
+func (d *Driver) LintFlags(flags drivers.DriverOptions) error {
+	d.ClientId = flags.String("vpsie-client-id")
+	d.ClientSecret = flags.String("vpsie-client-secret")
+	d.AccessToken = flags.String("vpsie-access-token")
+	d.Profile = flags.String("vpsie-profile")
+	d.VaultPath = flags.String("vpsie-vault-path")
+	d.EncryptState = flags.Bool("vpsie-encrypt-state")
+	d.SSHAgent = flags.Bool("vpsie-ssh-agent")
+	d.EncryptSSHKey = flags.Bool("vpsie-encrypt-ssh-key")
+	d.SSHKeyPath = flags.String("vpsie-ssh-key-path")
+	d.SSHUser = flags.String("vpsie-ssh-user")
+	d.SSHPort = flags.Int("vpsie-ssh-port")
+	d.UserDataFile = flags.String("vpsie-userdata")
+	d.KeepPasswordAuth = flags.Bool("vpsie-keep-password-auth")
+	d.ImageID = flags.String("vpsie-image-id")
+	d.DatacenterID = flags.String("vpsie-datacenter-id")
+	d.OfferID = flags.String("vpsie-offer-id")
+	d.Image = flags.String("vpsie-image")
+	d.Datacenter = flags.String("vpsie-datacenter")
+	d.Offer = flags.String("vpsie-offer")
+	d.FallbackDatacenterIDs = flags.StringSlice("vpsie-fallback-datacenter-id")
+	d.CreateRetries = flags.Int("vpsie-create-retries")
+	d.Preset = flags.String("vpsie-preset")
+	d.PresetsFile = flags.String("vpsie-presets-file")
+	d.SkipValidation = flags.Bool("vpsie-skip-validation")
+	d.CatalogTTL = flags.Int("vpsie-catalog-ttl")
+	d.RefreshCatalog = flags.Bool("vpsie-refresh-catalog")
+	d.NoCache = flags.Bool("vpsie-no-cache")
+	d.AllowTiny = flags.Bool("vpsie-allow-tiny")
+	d.MinCPU = flags.Int("vpsie-min-cpu")
+	d.MinRAM = flags.Int("vpsie-min-ram")
+	d.MinDisk = flags.Int("vpsie-min-disk")
+	d.MinFreeDisk = flags.Int("vpsie-min-free-disk")
+	d.Strict = flags.Bool("vpsie-strict")
+	d.ShutdownTimeout = flags.Int("vpsie-shutdown-timeout")
+	d.CloudInitTimeout = flags.Int("vpsie-cloud-init-timeout")
+	d.CreateTimeout = flags.Int("vpsie-create-timeout")
+	d.PollInterval = flags.Int("vpsie-poll-interval")
+	d.AutoStop = flags.String("vpsie-auto-stop")
+	d.ExternalID = flags.String("vpsie-external-id")
+	d.BillingTag = flags.String("vpsie-billing-tag")
+	d.Autoscaler = flags.Bool("vpsie-autoscaler")
+	d.RollbackOnInterrupt = flags.Bool("vpsie-rollback-on-interrupt")
+	d.NoCleanupOnFailure = flags.Bool("vpsie-no-cleanup-on-failure")
+	d.SnapshotOnRemove = flags.Bool("vpsie-snapshot-on-remove")
+	d.StateCacheTTL = flags.Int("vpsie-state-cache-ttl")
+	d.CacheToken = flags.Bool("vpsie-cache-token")
+	d.NameConflict = flags.String("vpsie-name-conflict")
+	d.ReuseExisting = flags.Bool("vpsie-reuse-existing")
+	d.NATMap = flags.StringSlice("vpsie-nat-map")
+	d.Tags = flags.StringSlice("vpsie-tag")
+	d.URLHostname = flags.String("vpsie-url-hostname")
+	d.PrivateNetworking = flags.Bool("vpsie-private-networking")
+	d.UsePrivateIP = flags.Bool("vpsie-use-private-ip")
+	d.IPv6 = flags.Bool("vpsie-ipv6")
+	d.UseIPv6 = flags.Bool("vpsie-use-ipv6")
+	d.Backups = flags.Bool("vpsie-backups")
+	d.Pool = flags.String("vpsie-pool")
+	d.PoolSize = flags.Int("vpsie-pool-size")
+	d.DNSHook = flags.String("vpsie-dns-hook")
+	d.MetricsAddr = flags.String("vpsie-metrics-addr")
+	d.APIURL = flags.String("vpsie-api-url")
+	d.APIInsecure = flags.Bool("vpsie-api-insecure")
+	d.APICACert = flags.String("vpsie-api-ca-cert")
+	d.DebugAPI = flags.Bool("vpsie-debug-api")
+	d.APITrace = flags.String("vpsie-api-trace")
+	d.APIBudget = flags.Int("vpsie-api-budget")
+	d.APIRetries = flags.Int("vpsie-api-retries")
+	d.APIRetryInterval = flags.Int("vpsie-api-retry-interval")
+	d.MaxConcurrentCreates = flags.Int("vpsie-max-concurrent-creates")
+	d.BillingAlert = flags.Int("vpsie-billing-alert")
+	d.MaxMonthlyPrice = flags.Int("vpsie-max-monthly-price")
+	d.SwarmMaster = flags.Bool("swarm-master")
+	d.SwarmHost = flags.String("swarm-host")
+	d.SwarmDiscovery = flags.String("swarm-discovery")
+
+	// docker-machine starts the plugin process without stdin, so only the
+	// standalone commands can read the secret from it.
+	if d.ClientSecret == "-" {
+		return fmt.Errorf("VPSie driver cannot read the client secret from stdin, use --vpsie-client-secret-file or VPSIE_CLIENT_SECRET")
+	}
+	if secretFile := flags.String("vpsie-client-secret-file"); secretFile != "" {
+		if d.ClientSecret != "" {
+			return fmt.Errorf("VPSie driver accepts only one of --vpsie-client-secret and --vpsie-client-secret-file")
+		}
+		secret, err := ioutil.ReadFile(secretFile)
+		if err != nil {
+			return fmt.Errorf("Error reading VPSie client secret file: %s", err)
+		}
+		d.ClientSecret = strings.TrimSpace(string(secret))
+	}
+
+	if d.Autoscaler {
+		d.applyAutoscalerProfile()
+	}
+
+	if err := d.validateCredentialSources(); err != nil {
+		return err
+	}
+	if d.Preset != "" {
+		if err := d.applyPreset(); err != nil {
+			return err
+		}
+	} else if d.PresetsFile != "" {
+		return fmt.Errorf("VPSie driver requires the --vpsie-preset option with --vpsie-presets-file")
+	}
+	if d.EncryptState && os.Getenv(StateKeyEnv) == "" {
+		return fmt.Errorf("VPSie driver requires %s with --vpsie-encrypt-state", StateKeyEnv)
+	}
+	if d.UserDataFile != "" {
+		if err := validateUserData(d.UserDataFile); err != nil {
+			return err
+		}
+	}
+	if err := validateSSHUser(d.SSHUser); err != nil {
+		return err
+	}
+	if d.SSHKeyPath != "" {
+		if d.SSHAgent || d.EncryptSSHKey {
+			return fmt.Errorf("VPSie driver does not accept --vpsie-ssh-agent or --vpsie-encrypt-ssh-key with --vpsie-ssh-key-path")
+		}
+		if _, err := os.Stat(d.SSHKeyPath + ".pub"); err != nil {
+			return fmt.Errorf("VPSie driver requires the public key %s.pub with --vpsie-ssh-key-path", d.SSHKeyPath)
+		}
+	}
+	if d.EncryptSSHKey {
+		if d.SSHAgent {
+			return fmt.Errorf("VPSie driver accepts only one of --vpsie-ssh-agent and --vpsie-encrypt-ssh-key")
+		}
+		if os.Getenv(SSHKeyPassphraseEnv) == "" {
+			return fmt.Errorf("VPSie driver requires %s with --vpsie-encrypt-ssh-key", SSHKeyPassphraseEnv)
+		}
+	}
+	if err := d.validateRanges(); err != nil {
+		return err
+	}
+	if d.AutoStop != "" {
+		if err := validateAutoStop(d.AutoStop); err != nil {
+			return err
+		}
+	}
+	if err := d.validateCreationSources(); err != nil {
+		return err
+	}
+	if d.URLHostname != "" && !isDNSName(d.URLHostname) {
+		return fmt.Errorf("Invalid --vpsie-url-hostname %q, expected a DNS name", d.URLHostname)
+	}
+	if err := validateAPIURL(d.APIURL); err != nil {
+		return err
+	}
+	if d.APICACert != "" {
+		if _, err := loadCACert(d.APICACert); err != nil {
+			return err
+		}
+	}
+	if d.UsePrivateIP && !d.PrivateNetworking {
+		return fmt.Errorf("VPSie driver requires --vpsie-private-networking with --vpsie-use-private-ip")
+	}
+	if d.UseIPv6 && !d.IPv6 {
+		return fmt.Errorf("VPSie driver requires --vpsie-ipv6 with --vpsie-use-ipv6")
+	}
+	if d.UseIPv6 && d.UsePrivateIP {
+		return fmt.Errorf("VPSie driver accepts only one of --vpsie-use-ipv6 and --vpsie-use-private-ip")
+	}
+	if err := validateTags(d.Tags); err != nil {
+		return err
+	}
+	if err := validateNoteValue("vpsie-billing-tag", d.BillingTag); err != nil {
+		return err
+	}
+	if err := validateNoteValue("vpsie-external-id", d.ExternalID); err != nil {
+		return err
+	}
+	if _, err := parseNATMap(d.NATMap, d.SSHPort); err != nil {
+		return err
+	}
+	if err := validateNameConflict(d.NameConflict); err != nil {
+		return err
+	}
+	if err := validateDNSHook(d.DNSHook); err != nil {
+		return err
+	}
+	if d.MetricsAddr != "" {
+		if err := validateMetricsAddr(d.MetricsAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// intRange bounds an integer option, max 0 leaving it unbounded.
+type intRange struct {
+	option   string
+	value    int
+	min, max int
+}
+
+func (d *Driver) validateRanges() error {
+	ranges := []intRange{
+		{"vpsie-ssh-port", d.SSHPort, 1, 65535},
+		{"vpsie-create-retries", d.CreateRetries, 0, 10},
+		{"vpsie-catalog-ttl", d.CatalogTTL, 0, 0},
+		{"vpsie-state-cache-ttl", d.StateCacheTTL, 0, 300},
+		{"vpsie-min-cpu", d.MinCPU, 0, 0},
+		{"vpsie-min-ram", d.MinRAM, 0, 0},
+		{"vpsie-min-disk", d.MinDisk, 0, 0},
+		{"vpsie-min-free-disk", d.MinFreeDisk, 0, 0},
+		{"vpsie-shutdown-timeout", d.ShutdownTimeout, 1, 3600},
+		{"vpsie-cloud-init-timeout", d.CloudInitTimeout, 0, 3600},
+		{"vpsie-create-timeout", d.CreateTimeout, 30, 7200},
+		{"vpsie-poll-interval", d.PollInterval, 1, 60},
+		{"vpsie-pool-size", d.PoolSize, 0, 100},
+		{"vpsie-api-budget", d.APIBudget, 0, 0},
+		{"vpsie-api-retries", d.APIRetries, 0, 10},
+		{"vpsie-api-retry-interval", d.APIRetryInterval, 1, 60},
+		{"vpsie-max-concurrent-creates", d.MaxConcurrentCreates, 0, 100},
+		{"vpsie-billing-alert", d.BillingAlert, 0, 0},
+		{"vpsie-max-monthly-price", d.MaxMonthlyPrice, 0, 0},
+	}
+
+	for _, r := range ranges {
+		if r.max > 0 && (r.value < r.min || r.value > r.max) {
+			return fmt.Errorf("VPSie driver requires --%s between %d and %d, got %d", r.option, r.min, r.max, r.value)
+		} else if r.value < r.min {
+			return fmt.Errorf("VPSie driver requires --%s of at least %d, got %d", r.option, r.min, r.value)
+		}
+	}
+	return nil
+}
+
+// validateCreationSources rejects combinations of the options choosing what
+// a VPS is created from that would silently ignore one of them. Image,
+// datacenter and offer IDs or names on the command line take precedence
+// over a preset, and a VPS claimed from a pool takes precedence over both.
+func (d *Driver) validateCreationSources() error {
+	if err := validatePool(d.Pool, d.PoolSize); err != nil {
+		return err
+	}
+	names := []struct {
+		name, option, id, idOption, defaultID string
+	}{
+		{d.Image, "--vpsie-image", d.ImageID, "--vpsie-image-id", defaultImageID},
+		{d.Offer, "--vpsie-offer", d.OfferID, "--vpsie-offer-id", defaultOfferID},
+		{d.Datacenter, "--vpsie-datacenter", d.DatacenterID, "--vpsie-datacenter-id", defaultDatacenterID},
+	}
+	for _, n := range names {
+		if n.name != "" && n.id != n.defaultID {
+			return fmt.Errorf("VPSie driver accepts only one of %s and %s", n.option, n.idOption)
+		}
+	}
+	if d.Pool != "" {
+		metadata := []struct{ option, value string }{
+			{"--vpsie-auto-stop", d.AutoStop},
+			{"--vpsie-billing-tag", d.BillingTag},
+			{"--vpsie-external-id", d.ExternalID},
+			{"--vpsie-tag", strings.Join(d.Tags, ",")},
+		}
+		for _, m := range metadata {
+			if m.value != "" {
+				return fmt.Errorf("VPSie driver does not accept %s with --vpsie-pool, pooled VPSes keep their pool note", m.option)
+			}
+		}
+		if d.PrivateNetworking {
+			return fmt.Errorf("VPSie driver does not accept --vpsie-private-networking with --vpsie-pool, pooled VPSes have no private network")
+		}
+		if d.IPv6 {
+			return fmt.Errorf("VPSie driver does not accept --vpsie-ipv6 with --vpsie-pool, pooled VPSes have no IPv6 address")
+		}
+		if d.Backups {
+			return fmt.Errorf("VPSie driver does not accept --vpsie-backups with --vpsie-pool, pooled VPSes have no automatic backups")
+		}
+	}
+	for _, datacenterID := range d.FallbackDatacenterIDs {
+		if datacenterID == d.DatacenterID {
+			return fmt.Errorf("VPSie datacenter %s is both the datacenter and a fallback datacenter", datacenterID)
+		}
+	}
+	return nil
+}
+
+func (d *Driver) PreCreateCheck() error {
+	log.Info("Validating VPSie VPS parameters...")
+
+	if err := d.checkAPIStatus(); err != nil {
+		return err
+	}
+
+	if err := d.resolveNames(); err != nil {
+		return err
+	}
+
+	// The hostname is checked again by Create, as parallel creates can
+	// take it in between. Pool fills have no machine, FillPool names the
+	// VPSes it creates.
+	if d.MachineName != "" {
+		if err := d.chooseHostname(); err != nil {
+			return err
+		}
+	}
+
+	if d.Preset != "" {
+		if err := d.resolvePresetOffer(); err != nil {
+			return err
+		}
+	}
+
+	if d.SkipValidation {
+		log.Info("Skipping VPSie image, datacenter and offer validation")
+		if d.MaxMonthlyPrice > 0 {
+			return d.checkOfferPrice()
+		}
+		return nil
+	}
+
+	d.prefetchCatalogs()
+
+	if err := d.validateImageID(); err != nil {
+		return err
+	}
+
+	if err := d.validateDatacenterID(); err != nil {
+		return err
+	}
+
+	if err := d.validateOfferID(); err != nil {
+		return err
+	}
+
+	return d.checkOfferPrice()
+}
+
+func (d *Driver) Create() (err error) {
+	start := time.Now()
+	defer func() {
+		driverMetrics.observeCreate(time.Since(start), err)
+	}()
+
+	log.Info("Creating VPSie VPS...")
+
+	unlock, err := d.lockMachine()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stopHandling := d.handleInterrupts(unlock)
+	defer stopHandling()
+
+	// The SSH key is generated while the API checks run and a create slot
+	// is awaited.
+	var sshKey []byte
+	release := func() {}
+	defer func() { release() }()
+	err = parallel(
+		func() (err error) {
+			sshKey, err = d.createSSHKey()
+			return err
+		},
+		func() error {
+			if err := d.checkBillingAlert(); err != nil {
+				return err
+			}
+			if d.MaxConcurrentCreates > 0 {
+				var err error
+				if release, err = acquireCreateSlot(d.sharedDir(), d.MaxConcurrentCreates); err != nil {
+					return err
+				}
+			}
+			return d.chooseHostname()
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	create := vpsie.CreateVPSie{
+		Hostname:     d.Hostname,
+		OfferId:      d.OfferID,
+		DatacenterId: d.DatacenterID,
+		OsId:         d.ImageID,
+	}
+	if note := formatNote(d.metadata()); note != "" {
+		create.Note = &note
+	}
+	if d.PrivateNetworking {
+		create.PrivateIp = &d.PrivateNetworking
+	}
+	if d.IPv6 {
+		create.IpV6 = &d.IPv6
+	}
+	if d.Backups {
+		create.AutoBackup = &d.Backups
+	}
+
+	if d.Pool != "" {
+		defer d.refillPool()
+	}
+
+	var instance vpsie.VPSie
+	if d.reuse != nil {
+		if instance, err = d.adoptInstance(*d.reuse); err != nil {
+			return err
+		}
+	} else if pooled, ok := d.claimPooled(); ok {
+		if instance, err = d.claimInstance(pooled); err != nil {
+			return err
+		}
+	} else if instance, err = d.createVPSie(create); err != nil {
+		return err
+	}
+	d.InstanceID = instance.Id
+	d.setAddresses(instance)
+	j := &journal{
+		Operation:   "create",
+		InstanceID:  d.InstanceID,
+		IPAddress:   d.IPAddress,
+		PrivateIP:   d.PrivateIP,
+		IPv6Address: d.IPv6Address,
+	}
+	d.recordStep(j, stepInstanceCreated)
+
+	defer func() {
+		if err != nil {
+			d.cleanupFailedCreate(err)
+		}
+	}()
+
+	if !validIPv4(instance.IpV4) {
+		if instance, err = d.waitForAddress(instance); err != nil {
+			return err
+		}
+		d.setAddresses(instance)
+		j.IPAddress, j.PrivateIP, j.IPv6Address = d.IPAddress, d.PrivateIP, d.IPv6Address
+		if err := d.saveJournal(j); err != nil {
+			log.Warnf("Error writing VPSie journal: %s", err)
+		}
+	}
+
+	if d.UsePrivateIP && d.PrivateIP == "" {
+		return fmt.Errorf("VPSie VPS %s has no private IP address", d.InstanceID)
+	}
+	if d.UseIPv6 && d.IPv6Address == "" {
+		return fmt.Errorf("VPSie VPS %s has no IPv6 address", d.InstanceID)
+	}
+
+	log.Infof("Created VPSie VPS ID: %s, Public IP: %s",
+		d.InstanceID,
+		d.IPAddress,
+	)
+
+	// The hook runs before SSH is used, so a --vpsie-url-hostname record
+	// it creates is in place for provisioning.
+	d.runDNSHook("create")
+
+	// VPSes claimed from a pool, and some created ones, are already running.
+	running := instance.Status == "Running" && validIPv4(instance.IpV4)
+	if err := d.addSshKeyToServer(instance.Password, sshKey, running); err != nil {
+		return err
+	}
+	d.recordStep(j, stepKeyInstalled)
+
+	d.logCreateSummary(instance)
+
+	if err := d.lockRootPassword(); err != nil {
+		return err
+	}
+	d.recordStep(j, stepPasswordLocked)
+
+	if err := d.runUserData(); err != nil {
+		return err
+	}
+	d.recordStep(j, stepUserDataRun)
+
+	if err := d.checkFreeDisk(); err != nil {
+		return err
+	}
+	d.recordStep(j, stepDiskChecked)
+
+	if j.complete() {
+		d.clearJournal()
+	}
+	return nil
+}
+
+func (d *Driver) GetURL() (string, error) {
+	s, err := d.GetState()
+	if err != nil {
+		return "", err
+	}
+
+	if s != state.Running {
+		return "", drivers.ErrHostIsNotRunning
+	}
+
+	if host, port, ok := d.natAddress(dockerPort); ok {
+		return fmt.Sprintf("tcp://%s", net.JoinHostPort(host, strconv.Itoa(port))), nil
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, strconv.Itoa(dockerPort))), nil
+}
+
+// setAddresses records the addresses of the machine VPS.
+func (d *Driver) setAddresses(instance vpsie.VPSie) {
+	d.IPAddress = instance.IpV4
+	d.PrivateIP = instance.PrivateIp
+	d.IPv6Address = instance.IpV6
+}
+
+// GetIP returns the NAT gateway address when the Docker port is forwarded,
+// the --vpsie-url-hostname DNS name, or the private or IPv6 address with
+// --vpsie-use-private-ip or --vpsie-use-ipv6, as docker-machine issues the
+// Docker server certificate for this address.
+func (d *Driver) GetIP() (string, error) {
+	if host, _, ok := d.natAddress(dockerPort); ok {
+		return host, nil
+	}
+	if d.URLHostname != "" {
+		return d.URLHostname, nil
+	}
+	if d.UsePrivateIP {
+		if d.PrivateIP == "" {
+			return "", fmt.Errorf("Private IP address is not set")
+		}
+		return d.PrivateIP, nil
+	}
+	if d.UseIPv6 {
+		if d.IPv6Address == "" {
+			return "", fmt.Errorf("IPv6 address is not set")
+		}
+		return d.IPv6Address, nil
+	}
+	if d.IPAddress == "" || d.IPAddress == "0" {
+		return "", fmt.Errorf("IP address is not set")
+	}
+	return d.IPAddress, nil
+}
+
+// GetState reports state.None for a machine whose VPS no longer exists, so
+// docker-machine ls and rm keep working after it is deleted from the VPSie
+// panel.
+func (d *Driver) GetState() (state.State, error) {
+	if err := d.ensureInstanceID(); err == errInstanceNotFound {
+		return state.None, nil
+	} else if err != nil {
+		return state.Error, err
+	}
+
+	machine, err := d.getVPSie()
+	if err == errInstanceNotFound {
+		log.Warnf("VPSie VPS %s no longer exists", d.InstanceID)
+		return state.None, nil
+	} else if err != nil {
+		return state.Error, err
+	}
+	switch machine.Status {
+	case "Started":
+		return state.Starting, nil
+	case "Running":
+		return state.Running, nil
+	case "Stopped":
+		return state.Stopped, nil
+	}
+	if isMaintenanceStatus(machine.Status) {
+		log.Warnf("VPSie VPS %s is under maintenance (%s)", d.InstanceID, machine.Status)
+		return state.Paused, nil
+	}
+	if s, ok := statusState(machine.Status); ok {
+		return s, nil
+	}
+	log.Warnf("Unknown status %q of VPSie VPS %s", machine.Status, d.InstanceID)
+	return state.Error, nil
+}
+
+// getVPSie reads the machine VPS from the state cache when it is enabled,
+// except while this process is acting on the machine and waits for changes.
+func (d *Driver) getVPSie() (vpsie.VPSie, error) {
+	if d.StateCacheTTL > 0 && !d.acting {
+		instances, err := d.instances()
+		if err != nil {
+			return vpsie.VPSie{}, err
+		}
+		for _, instance := range instances {
+			if instance.Id == d.InstanceID {
+				return instance, nil
+			}
+		}
+	}
+
+	instance, err := d.getClient().GetVPSie(d.InstanceID)
+	if err == nil && instance.Id == "" && isNotFoundResponse(lastAPIResponse()) {
+		return instance, errInstanceNotFound
+	}
+	return instance, err
+}
+
+// isMaintenanceStatus recognizes the statuses VPSie reports while a VPS is
+// being maintained or migrated to another host. Those are reported as Paused
+// so fleet tooling doesn't recreate machines that will come back by
+// themselves.
+func isMaintenanceStatus(status string) bool {
+	status = strings.ToLower(status)
+	return strings.Contains(status, "maint") || strings.Contains(status, "migrat")
+}
+
+// Words of the transitional and suspended statuses VPSie reports, in the
+// order they are matched.
+var statusStates = []struct {
+	word  string
+	state state.State
+}{
+	{"delet", state.None},
+	{"destroy", state.None},
+	{"terminat", state.None},
+	{"stopping", state.Stopping},
+	{"shutting", state.Stopping},
+	{"provision", state.Starting},
+	{"creat", state.Starting},
+	{"install", state.Starting},
+	{"build", state.Starting},
+	{"pending", state.Starting},
+	{"boot", state.Starting},
+	{"start", state.Starting},
+	{"reboot", state.Starting},
+	{"restart", state.Starting},
+	{"rebuild", state.Starting},
+	{"resiz", state.Starting},
+	{"suspend", state.Paused},
+	{"pause", state.Paused},
+	{"lock", state.Paused},
+	{"stop", state.Stopped},
+	{"shutdown", state.Stopped},
+	{"off", state.Stopped},
+}
+
+func statusState(status string) (state.State, bool) {
+	status = strings.ToLower(status)
+	for _, s := range statusStates {
+		if strings.Contains(status, s.word) {
+			return s.state, true
+		}
+	}
+	return state.Error, false
+}
+
+func (d *Driver) Start() error {
+	unlock, err := d.lockMachine()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.resumeCreate(); err != nil {
+		return err
+	}
+	if err := d.ensureInstanceID(); err != nil {
+		return err
+	}
+	return d.start()
+}
+
+func (d *Driver) start() error {
+	status, err := d.getClient().StartVPSie(d.InstanceID)
+	if err != nil {
+		return err
+	} else if status != "Started" {
+		return apiError("Invalid status %s after start", status)
+	}
+	return nil
+}
+
+func (d *Driver) Stop() error {
+	unlock, err := d.lockMachine()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.ensureInstanceID(); err != nil {
+		return err
+	}
+	return d.stop()
+}
+
+func (d *Driver) stop() error {
+	actionStatus, err := d.getClient().ShutdownVPSie(d.InstanceID)
+	if err != nil {
+		return err
+	} else if actionStatus.Error {
+		return apiError("VPSie action failed: %s", actionStatus.ErrorCode)
+	}
+
+	timeout := d.shutdownTimeout()
+	log.Infof("Waiting up to %s for VPSie VPS to shut down...", timeout)
+	if err := d.waitForState(state.Stopped, timeout); err == nil {
+		log.Info("VPSie VPS stopped using ACPI shutdown")
+		return nil
+	}
+
+	log.Warn("VPSie VPS did not shut down in time, forcing power off...")
+	if err := d.forcePowerOff(timeout); err != nil {
+		return fmt.Errorf("VPSie VPS could not be forced off: %s", err)
+	}
+	log.Info("VPSie VPS stopped using forced power off")
+	return nil
+}
+
+// forcePowerOff stops a VPS whose guest ignores the ACPI shutdown request,
+// through the API since such a guest rarely answers SSH either. The VPSie API
+// has no hard power off, so the VPS is hard reset, which clears a hung guest,
+// and shut down again once it is running.
+func (d *Driver) forcePowerOff(timeout time.Duration) error {
+	if _, err := d.getClient().ForceRestartVPSie(d.InstanceID); err != nil {
+		return err
+	}
+	if err := d.waitForState(state.Running, timeout); err != nil {
+		return fmt.Errorf("VPSie VPS not running after hard reset: %s", err)
+	}
+
+	actionStatus, err := d.getClient().ShutdownVPSie(d.InstanceID)
+	if err != nil {
+		return err
+	} else if actionStatus.Error {
+		return apiError("VPSie action failed: %s", actionStatus.ErrorCode)
+	}
+	return d.waitForState(state.Stopped, timeout)
+}
+
+func (d *Driver) Remove() (err error) {
+	defer func() {
+		driverMetrics.observeRemove(err)
+	}()
+
+	unlock, err := d.lockMachine()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if j, err := d.loadJournal(); err == nil && d.InstanceID == "" {
+		d.InstanceID = j.InstanceID
+	}
+	// A VPS is never deleted on a name match alone: without an InstanceID,
+	// the machine is only removed when no VPS could be its own.
+	if d.InstanceID == "" {
+		matches, err := d.matchingInstances()
+		if err != nil {
+			return err
+		} else if len(matches) > 0 {
+			return fmt.Errorf("Machine %s has no VPSie VPS ID but VPS %s may be its own, set the InstanceID in its config.json to remove it", d.MachineName, matches[0].Id)
+		}
+		log.Warnf("No VPSie VPS found for machine %s, removing it anyway", d.MachineName)
+		d.clearJournal()
+		return nil
+	}
+
+	instance, err := d.getVPSie()
+	if err == errInstanceNotFound {
+		log.Warnf("VPSie VPS %s was already deleted", d.InstanceID)
+		d.forgetClaimed(d.InstanceID)
+		d.clearJournal()
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := d.verifyOwnership(instance); err != nil {
+		return err
+	}
+
+	if d.SnapshotOnRemove {
+		if err := d.finalSnapshot(); err != nil {
+			return err
+		}
+	}
+
+	d.runDNSHook("remove")
+
+	status, err := d.getClient().DeleteVPSie(d.InstanceID)
+	if err != nil {
+		return err
+	} else if status != "Deleted" {
+		if _, err := d.getVPSie(); err == errInstanceNotFound {
+			log.Warnf("VPSie VPS %s was already deleted", d.InstanceID)
+			d.forgetClaimed(d.InstanceID)
+			d.clearJournal()
+			return nil
+		}
+		return apiError("Invalid status %s after remove", status)
+	}
+	d.forgetClaimed(d.InstanceID)
+	d.clearJournal()
+	return nil
+}
+
+func (d *Driver) Restart() error {
+	unlock, err := d.lockMachine()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.ensureInstanceID(); err != nil {
+		return err
+	}
+
+	status, err := d.getClient().RestartVPSie(d.InstanceID)
+	if err == nil && status == "Restarted" {
+		return nil
+	}
+	if err == nil {
+		err = apiError("Invalid status %s after restart", status)
+	}
+
+	log.Warnf("VPSie restart failed, stopping and starting the VPS instead: %s", err)
+	if err := d.stop(); err != nil {
+		return fmt.Errorf("Error stopping VPSie VPS for restart: %s", err)
+	}
+	if err := d.start(); err != nil {
+		return fmt.Errorf("Error starting VPSie VPS for restart: %s", err)
+	}
+	if err := d.waitForState(state.Running, d.shutdownTimeout()); err != nil {
+		return fmt.Errorf("VPSie VPS not running after restart: %s", err)
+	}
+	return nil
 }
 
-func NewDriver(hostName, storePath string) *Driver {
-	d := &Driver{
-		ImageID:      defaultImageID,
-		OfferID:      defaultOfferID,
-		DatacenterID: defaultDatacenterID,
-		BaseDriver: &drivers.BaseDriver{
-			MachineName: hostName,
-			StorePath:   storePath,
-			SSHUser:     SSHUser,
-			SSHPort:     SSHPort,
-		},
+func (d *Driver) Kill() error {
+	unlock, err := d.lockMachine()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.ensureInstanceID(); err != nil {
+		return err
+	}
+
+	// The VPSie API has no hard power off, so the guest is powered off over
+	// SSH, and hard reset and shut down through the API when SSH is not
+	// answering.
+	log.Info("Forcing power off of VPSie VPS...")
+	if err := d.powerOff(); err != nil {
+		log.Warnf("Error forcing power off over SSH, forcing it through the VPSie API: %s", err)
+		if err := d.forcePowerOff(d.shutdownTimeout()); err != nil {
+			return fmt.Errorf("VPSie VPS could not be forced off: %s", err)
+		}
+		return nil
 	}
-	return d
+	if err := d.waitForState(state.Stopped, d.shutdownTimeout()); err != nil {
+		return fmt.Errorf("VPSie VPS still running after kill: %s", err)
+	}
+	return nil
 }
 
-func (d *Driver) GetCreateFlags() []mcnflag.Flag {
-	return []mcnflag.Flag{
-		mcnflag.StringFlag{
-			EnvVar: "VPSIE_CLIENT_ID",
-			Name:   "vpsie-client-id",
-			Usage:  "VPSie Client ID",
-		},
-		mcnflag.StringFlag{
-			EnvVar: "VPSIE_CLIENT_SECRET",
-			Name:   "vpsie-client-secret",
-			Usage:  "VPSie Client secret",
-		},
-		mcnflag.StringFlag{
-			EnvVar: "VPSIE_IMAGE_ID",
-			Name:   "vpsie-image-id",
-			Usage:  "VPSie Image ID",
-			Value:  defaultImageID,
-		},
-		mcnflag.StringFlag{
-			EnvVar: "VPSIE_OFFER_ID",
-			Name:   "vpsie-offer-id",
-			Usage:  "VPSie Offer ID",
-			Value:  defaultOfferID,
-		},
-		mcnflag.StringFlag{
-			EnvVar: "VPSIE_DATACENTER_ID",
-			Name:   "vpsie-datacenter-id",
-			Usage:  "VPSie Datacenter ID",
-			Value:  defaultDatacenterID,
-		},
+func (d *Driver) getClient() apiClient {
+	log.Debug("getting client")
+	if d.client == nil {
+		if err := d.installTransport(); err != nil {
+			d.client = unavailableClient{fmt.Errorf("Error setting up the VPSie API transport: %s", err)}
+			return d.client
+		}
+		d.serveMetrics()
+		clientID, clientSecret, err := d.credentials()
+		if err != nil {
+			d.client = unavailableClient{fmt.Errorf("Error getting VPSie credentials: %s", err)}
+			return d.client
+		}
+		d.client = newAPIClient(clientID, clientSecret)
 	}
+	return d.client
 }
 
-func (d *Driver) GetSSHHostname() (string, error) {
-	return d.GetIP()
+// sharedDir holds the state shared by the plugin processes of every VPSie
+// machine in the store.
+func (d *Driver) sharedDir() string {
+	return filepath.Join(d.StorePath, "vpsie")
 }
 
-func (d *Driver) DriverName() string {
-	return "vpsie"
+// credentials are read from Vault on every invocation when a Vault path is
+// set, so they never end up in the machine store.
+func (d *Driver) credentials() (string, string, error) {
+	switch {
+	case d.VaultPath != "":
+		return readVaultCredentials(d.VaultPath)
+	case d.Profile != "":
+		profile, err := readProfile(d.Profile)
+		if err != nil {
+			return "", "", err
+		}
+		return profile[profileClientID], profile[profileClientSecret], nil
+	}
+	clientSecret, err := decryptState(d.ClientSecret)
+	return d.ClientId, clientSecret, err
 }
 
-func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
-	d.ClientId = flags.String("vpsie-client-id")
-	d.ClientSecret = flags.String("vpsie-client-secret")
-	d.ImageID = flags.String("vpsie-image-id")
-	d.DatacenterID = flags.String("vpsie-datacenter-id")
-	d.OfferID = flags.String("vpsie-offer-id")
-	d.SwarmMaster = flags.Bool("swarm-master")
-	d.SwarmHost = flags.String("swarm-host")
-	d.SwarmDiscovery = flags.String("swarm-discovery")
+// accessToken returns the API token used instead of the client ID and
+// secret, if any.
+func (d *Driver) accessToken() (string, error) {
+	if d.Profile != "" {
+		profile, err := readProfile(d.Profile)
+		if err != nil {
+			return "", err
+		}
+		return profile[profileAccessToken], nil
+	}
+	return decryptState(d.AccessToken)
+}
 
-	if d.ClientId == "" {
-		return fmt.Errorf("VPSie driver requires the --vpsie-client-id option")
+// validateCredentialSources checks a single source of credentials is given:
+// a client ID and secret, an access token, a Vault path, or a profile of the
+// credentials file, which is used by default when there are no others.
+func (d *Driver) validateCredentialSources() error {
+	clientGiven := d.ClientId != "" || d.ClientSecret != ""
+	sources := 0
+	for _, given := range []bool{clientGiven, d.AccessToken != "", d.VaultPath != "", d.Profile != ""} {
+		if given {
+			sources++
+		}
 	}
-	if d.ClientSecret == "" {
-		return fmt.Errorf("VPSie driver requires the --vpsie-client-secret option")
+	if sources > 1 {
+		return fmt.Errorf("VPSie driver accepts only one of the client ID/secret, --vpsie-access-token, --vpsie-vault-path and --vpsie-profile options")
+	}
+
+	switch {
+	case clientGiven && d.ClientId == "":
+		return fmt.Errorf("VPSie driver requires the --vpsie-client-id option")
+	case clientGiven && d.ClientSecret == "":
+		return fmt.Errorf("VPSie driver requires the --vpsie-client-secret or --vpsie-client-secret-file option")
+	case sources == 0:
+		if _, err := readProfile(defaultProfile); err != nil {
+			return fmt.Errorf("VPSie driver requires the --vpsie-client-id option or a %s profile in %s", defaultProfile, credentialsFile())
+		}
+		d.Profile = defaultProfile
+	case d.Profile != "":
+		if _, err := readProfile(d.Profile); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (d *Driver) PreCreateCheck() error {
-	log.Info("Validating VPSie VPS parameters...")
+func (d *Driver) chooseHostname() error {
+	d.Hostname = sanitizeHostname(d.MachineName)
+	if d.Hostname == "" {
+		return fmt.Errorf("Machine name %s cannot be used as a VPSie hostname", d.MachineName)
+	} else if d.Hostname != d.MachineName {
+		log.Infof("Using VPSie hostname %s for machine %s", d.Hostname, d.MachineName)
+	}
 
-	if err := d.validateImageID(); err != nil {
-		return err
+	// --vpsie-skip-validation keeps Create free of list calls.
+	if d.SkipValidation {
+		return nil
 	}
+	return d.resolveHostnameConflict()
+}
 
-	if err := d.validateDatacenterID(); err != nil {
-		return err
+// checkBillingAlert warns when the account monthly charge already exceeds the
+// configured threshold. The VPSie API has no server-side alerts, so this is
+// checked every time a machine is created.
+func (d *Driver) checkBillingAlert() error {
+	if d.BillingAlert == 0 {
+		return nil
 	}
 
-	if err := d.validateOfferID(); err != nil {
+	balance, err := d.getClient().GetBalance()
+	if err != nil {
 		return err
 	}
 
+	if balance.MonthlyCharge >= float32(d.BillingAlert) {
+		log.Warnf("VPSie account monthly charge %.2f exceeds billing alert threshold %d (current balance %.2f)",
+			balance.MonthlyCharge,
+			d.BillingAlert,
+			balance.CurrentBalance,
+		)
+	}
 	return nil
 }
 
-func (d *Driver) Create() error {
-	log.Info("Creating VPSie VPS...")
-
-	sshKey, err := d.createSSHKey()
+// checkOfferPrice logs the price of the offer and enforces
+// --vpsie-max-monthly-price. The VPSie API only gives offers a monthly price
+// in whole units of the account currency, so there is no hourly estimate.
+func (d *Driver) checkOfferPrice() error {
+	offer, err := d.getOffer()
 	if err != nil {
 		return err
 	}
 
-	instance, err := d.getClient().CreateVPSie(vpsie.CreateVPSie{
-		Hostname:     d.MachineName,
-		OfferId:      d.OfferID,
-		DatacenterId: d.DatacenterID,
-		OsId:         d.ImageID,
-	})
+	log.Infof("VPSie offer %s costs %d per month", d.OfferID, offer.Price)
+	if d.MaxMonthlyPrice > 0 && offer.Price > d.MaxMonthlyPrice {
+		return fmt.Errorf("VPSie offer %s costs %d per month, above --vpsie-max-monthly-price %d", d.OfferID, offer.Price, d.MaxMonthlyPrice)
+	}
+	return nil
+}
+
+// checkFreeDisk verifies the filesystem that will hold /var/lib/docker has
+// enough room left once the image template is installed.
+func (d *Driver) checkFreeDisk() error {
+	if d.MinFreeDisk <= 0 {
+		return nil
+	}
+
+	availableGB, err := d.freeDisk()
 	if err != nil {
 		return err
 	}
-	d.InstanceID = instance.Id
-	d.IPAddress = instance.IpV4
-
-	log.Infof("Created VPSie VPS ID: %s, Public IP: %s",
-		d.InstanceID,
-		d.IPAddress,
-	)
 
-	d.addSshKeyToServer(instance.Password, sshKey)
+	if availableGB >= int64(d.MinFreeDisk) {
+		return nil
+	}
 
+	msg := fmt.Sprintf("Only %d GB free for /var/lib/docker, less than the %d GB minimum", availableGB, d.MinFreeDisk)
+	if d.Strict {
+		return errors.New(msg)
+	}
+	log.Warn(msg)
 	return nil
 }
 
-func (d *Driver) GetURL() (string, error) {
-	s, err := d.GetState()
+// freeDisk returns the GB available for /var/lib/docker.
+func (d *Driver) freeDisk() (int64, error) {
+	out, err := drivers.RunSSHCommandFromDriver(d, "df -Pk /var/lib/docker 2>/dev/null || df -Pk /var/lib")
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
-	if s != state.Running {
-		return "", drivers.ErrHostIsNotRunning
+	available, err := parseDfAvailable(out)
+	if err != nil {
+		return 0, err
 	}
+	return available / 1024 / 1024, nil
+}
 
-	ip, err := d.GetIP()
-	if err != nil {
-		return "", err
+// applyAutoscalerProfile shortens the default timeouts, since autoscalers
+// prefer replacing a stuck machine over waiting for it, and records the
+// runner host in the VPS note.
+func (d *Driver) applyAutoscalerProfile() {
+	if d.ShutdownTimeout == defaultShutdownTimeout {
+		d.ShutdownTimeout = autoscalerShutdownTimeout
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		d.Runner = hostname
 	}
-	return fmt.Sprintf("tcp://%s:2376", ip), nil
 }
 
-func (d *Driver) GetIP() (string, error) {
-	if d.IPAddress == "" || d.IPAddress == "0" {
-		return "", fmt.Errorf("IP address is not set")
+func (d *Driver) metadata() map[string]string {
+	return map[string]string{
+		"auto-stop":    d.AutoStop,
+		"billing-tag":  d.BillingTag,
+		"runner":       d.Runner,
+		"external-id":  d.ExternalID,
+		"machine-name": d.MachineName,
+		"store-id":     d.StoreID,
+		"tags":         strings.Join(d.Tags, ","),
 	}
-	return d.IPAddress, nil
 }
 
-func (d *Driver) GetState() (state.State, error) {
-	machine, err := d.getClient().GetVPSie(d.InstanceID)
-	if err != nil {
-		return state.Error, err
+func (d *Driver) shutdownTimeout() time.Duration {
+	if d.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout * time.Second
 	}
-	switch machine.Status {
-	case "Started":
-		return state.Starting, nil
-	case "Running":
-		return state.Running, nil
-	case "Stopped":
-		return state.Stopped, nil
+	return time.Duration(d.ShutdownTimeout) * time.Second
+}
+
+func (d *Driver) createTimeout() time.Duration {
+	if d.CreateTimeout <= 0 {
+		return defaultCreateTimeout * time.Second
 	}
-	return state.Error, nil
+	return time.Duration(d.CreateTimeout) * time.Second
 }
 
-func (d *Driver) Start() error {
-	status, err := d.getClient().StartVPSie(d.InstanceID)
-	if err != nil {
-		return err
-	} else if status != "Started" {
-		return fmt.Errorf("Invalid status %s after start", status)
+func (d *Driver) pollInterval() time.Duration {
+	if d.PollInterval <= 0 {
+		return defaultPollInterval * time.Second
 	}
-	return nil
+	return time.Duration(d.PollInterval) * time.Second
 }
 
-func (d *Driver) Stop() error {
-	actionStatus, err := d.getClient().ShutdownVPSie(d.InstanceID)
+// waitFor polls f every --vpsie-poll-interval until it returns true or
+// timeout elapses.
+func (d *Driver) waitFor(f func() bool, timeout time.Duration) error {
+	attempts := int(timeout / d.pollInterval())
+	if attempts < 1 {
+		attempts = 1
+	}
+	return mcnutils.WaitForSpecific(f, attempts, d.pollInterval())
+}
+
+func (d *Driver) waitForState(desired state.State, timeout time.Duration) error {
+	return d.waitFor(drivers.MachineInState(d, desired), timeout)
+}
+
+func validIPv4(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() != nil && !parsed.IsUnspecified()
+}
+
+// waitForAddress polls a new VPS until it runs with an IPv4 address, as
+// VPSie can return an empty or "0" address until provisioning finishes.
+func (d *Driver) waitForAddress(instance vpsie.VPSie) (vpsie.VPSie, error) {
+	log.Info("Waiting for VPSie VPS to get an IP address...")
+	err := d.waitFor(func() bool {
+		live, err := d.getClient().GetVPSie(instance.Id)
+		if err != nil {
+			log.Debugf("Error getting VPSie VPS %s: %s", instance.Id, err)
+			return false
+		}
+		if !validIPv4(live.IpV4) || live.Status != "Running" {
+			return false
+		}
+		live.Password = instance.Password
+		instance = live
+		return true
+	}, d.createTimeout())
 	if err != nil {
-		return err
-	} else if actionStatus.Error {
-		return errors.New(actionStatus.ErrorCode)
+		return instance, fmt.Errorf("VPSie VPS %s has no IP address after %s", instance.Id, d.createTimeout())
+	}
+	return instance, nil
+}
+
+// powerOff halts the guest over SSH without going through init. The command
+// is detached so the SSH session can return before the connection drops.
+func (d *Driver) powerOff() error {
+	_, err := d.RunAsRoot("nohup sh -c 'sleep 1; poweroff -f' >/dev/null 2>&1 &")
+	return err
+}
+
+// checkAPIStatus performs a cheap authenticated call so an API outage is
+// reported before the catalog validation and create requests are attempted.
+func (d *Driver) checkAPIStatus() error {
+	if _, err := d.getClient().GetBalance(); err != nil {
+		return fmt.Errorf("VPSie API is unavailable, check https://vpsie.com for incidents: %s", err)
 	}
 	return nil
 }
 
-func (d *Driver) Remove() error {
-	status, err := d.getClient().DeleteVPSie(d.InstanceID)
+func (d *Driver) validateImageID() error {
+	image, err := d.getImage()
 	if err != nil {
 		return err
-	} else if status != "Deleted" {
-		return fmt.Errorf("Invalid status %s after remove", status)
 	}
-	return nil
+	return validateImageCompatibility(image)
 }
 
-func (d *Driver) Restart() error {
-	status, err := d.getClient().RestartVPSie(d.InstanceID)
+func (d *Driver) validateDatacenterID() error {
+	if _, err := d.getDatacenter(); err != nil {
+		return err
+	}
+
+	datacenters, err := d.datacenters()
 	if err != nil {
 		return err
-	} else if status != "Restarted" {
-		return fmt.Errorf("Invalid status %s after restart", status)
+	}
+
+	for _, fallbackID := range d.FallbackDatacenterIDs {
+		found := false
+		for _, datacenter := range datacenters {
+			if datacenter.Id == fallbackID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Fallback datacenter ID %s is invalid", fallbackID)
+		}
 	}
 	return nil
 }
 
-func (d *Driver) Kill() error {
-	actionStatus, err := d.getClient().ShutdownVPSie(d.InstanceID)
+func (d *Driver) validateOfferID() error {
+	offer, err := d.getOffer()
 	if err != nil {
 		return err
-	} else if actionStatus.Error {
-		return errors.New(actionStatus.ErrorCode)
 	}
-	return nil
-}
 
-func (d *Driver) getClient() vpsie.Client {
-	log.Debug("getting client")
-	if d.client == nil {
-		d.client = vpsie.NewClient(d.ClientId, d.ClientSecret, true)
+	if offer.Cpu >= d.MinCPU && offer.Ram >= d.MinRAM && offer.Ssd >= d.MinDisk {
+		return nil
 	}
-	return d.client
+
+	if d.AllowTiny {
+		log.Warnf("Offer ID %s is below the recommended minimum resources, Docker may run out of memory or disk", d.OfferID)
+		return nil
+	}
+
+	return fmt.Errorf("Offer ID %s (%d vCPU, %d MB RAM, %d GB SSD) is below the minimum of %d vCPU, %d MB RAM, %d GB SSD, use --vpsie-allow-tiny to create it anyway",
+		d.OfferID,
+		offer.Cpu,
+		offer.Ram,
+		offer.Ssd,
+		d.MinCPU,
+		d.MinRAM,
+		d.MinDisk,
+	)
 }
 
-func (d *Driver) validateImageID() error {
-	images, err := d.getClient().GetImages()
+func (d *Driver) getImage() (vpsie.Image, error) {
+	images, err := d.images()
 	if err != nil {
-		return err
+		return vpsie.Image{}, err
 	}
 
 	for _, image := range images {
 		if image.Id == d.ImageID {
-			return nil
+			return image, nil
 		}
 	}
 
-	return fmt.Errorf("Image ID %s is invalid", d.ImageID)
+	return vpsie.Image{}, fmt.Errorf("Image ID %s is invalid", d.ImageID)
 }
 
-func (d *Driver) validateDatacenterID() error {
-	datacenters, err := d.getClient().GetDatacenters()
+func (d *Driver) getDatacenter() (vpsie.Datacenter, error) {
+	datacenters, err := d.datacenters()
 	if err != nil {
-		return err
+		return vpsie.Datacenter{}, err
 	}
 
 	for _, datacenter := range datacenters {
 		if datacenter.Id == d.DatacenterID {
-			return nil
+			return datacenter, nil
 		}
 	}
 
-	return fmt.Errorf("Datacenter ID %s is invalid", d.DatacenterID)
+	return vpsie.Datacenter{}, fmt.Errorf("Datacenter ID %s is invalid", d.DatacenterID)
 }
 
-func (d *Driver) validateOfferID() error {
-	offers, err := d.getClient().GetOffers()
+func (d *Driver) getOffer() (vpsie.Offer, error) {
+	offers, err := d.offers()
 	if err != nil {
-		return err
+		return vpsie.Offer{}, err
 	}
 
 	for _, offer := range offers {
 		if offer.Id == d.OfferID {
-			return nil
+			return offer, nil
+		}
+	}
+
+	return vpsie.Offer{}, fmt.Errorf("Offer ID %s is invalid", d.OfferID)
+}
+
+// logCreateSummary logs the created VPS and records its details in the
+// driver state.
+func (d *Driver) logCreateSummary(instance vpsie.VPSie) {
+	datacenter := vpsie.Datacenter{Name: d.DatacenterID}
+	offer := vpsie.Offer{Cpu: instance.Cpu, Ram: instance.Ram, Ssd: instance.Ssd}
+	image := vpsie.Image{Name: d.ImageID}
+
+	// The catalogs are only fetched again when they were validated, so
+	// --vpsie-skip-validation keeps Create free of list calls.
+	if !d.SkipValidation {
+		if found, err := d.getDatacenter(); err != nil {
+			log.Debugf("Error getting datacenter for summary: %s", err)
+		} else {
+			datacenter = found
 		}
+		if found, err := d.getOffer(); err != nil {
+			log.Debugf("Error getting offer for summary: %s", err)
+		} else {
+			offer = found
+		}
+		if found, err := d.getImage(); err != nil {
+			log.Debugf("Error getting image for summary: %s", err)
+		} else {
+			image = found
+		}
+	}
+
+	d.DatacenterName = datacenter.Name
+	d.ImageName = image.Name
+	d.CPU, d.RAM, d.Disk, d.Traffic = offer.Cpu, offer.Ram, offer.Ssd, offer.Traffic
+	d.CreatedOn = instance.CreatedOn
+	if d.CreatedOn.IsZero() {
+		d.CreatedOn = time.Now()
+	}
+
+	privateIP := instance.PrivateIp
+	if privateIP == "" {
+		privateIP = "none"
+	}
+
+	log.Info("VPSie VPS summary:")
+	log.Infof("  Name:       %s (%s)", d.MachineName, d.InstanceID)
+	log.Infof("  Datacenter: %s (%s, %s)", datacenter.Name, datacenter.State, datacenter.Country)
+	log.Infof("  Offer:      %d vCPU, %d MB RAM, %d GB SSD, %d GB traffic", offer.Cpu, offer.Ram, offer.Ssd, offer.Traffic)
+	log.Infof("  Price:      %d", offer.Price)
+	log.Infof("  Image:      %s", image.Name)
+	log.Infof("  Public IP:  %s", d.IPAddress)
+	log.Infof("  Private IP: %s", privateIP)
+}
+
+// parseDfAvailable returns the available kilobytes from POSIX df output.
+func parseDfAvailable(out string) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("Unexpected df output: %s", out)
+	}
+	return strconv.ParseInt(fields[3], 10, 64)
+}
+
+// GetSSHKeyPath returns no key when using the SSH agent, so libmachine runs
+// the ssh binary without an identity file and it authenticates with the agent.
+func (d *Driver) GetSSHKeyPath() string {
+	if d.SSHAgent {
+		return ""
+	}
+	return d.BaseDriver.GetSSHKeyPath()
+}
+
+// agentPublicKeys lists the keys of the running ssh-agent to install them
+// on the machine.
+func agentPublicKeys() ([]byte, error) {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return nil, fmt.Errorf("SSH_AUTH_SOCK must be set to use --vpsie-ssh-agent")
 	}
 
-	return fmt.Errorf("Offer ID %s is invalid", d.OfferID)
+	keys, err := exec.Command("ssh-add", "-L").Output()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing ssh-agent keys: %s", err)
+	}
+	return bytes.TrimSpace(keys), nil
 }
 
 func (d *Driver) publicSSHKeyPath() string {
@@ -306,36 +1961,78 @@ func (d *Driver) publicSSHKeyPath() string {
 }
 
 func (d *Driver) createSSHKey() ([]byte, error) {
-	if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
-		return nil, err
+	if d.SSHAgent {
+		return d.publicKey()
 	}
 
-	publicKey, err := ioutil.ReadFile(d.publicSSHKeyPath())
-	if err != nil {
+	if d.SSHKeyPath != "" {
+		if err := copySSHKey(d.SSHKeyPath, d.GetSSHKeyPath()); err != nil {
+			return nil, err
+		}
+	} else if d.EncryptSSHKey {
+		if err := generateEncryptedSSHKey(d.GetSSHKeyPath()); err != nil {
+			return nil, err
+		}
+		if err := addKeyToAgent(d.GetSSHKeyPath()); err != nil {
+			return nil, err
+		}
+	} else if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
 		return nil, err
 	}
 
-	return publicKey, nil
+	return d.publicKey()
+}
+
+// publicKey returns the key authorized on the VPS: the agent keys with
+// --vpsie-ssh-agent, or the public half of the machine key.
+func (d *Driver) publicKey() ([]byte, error) {
+	if d.SSHAgent {
+		return agentPublicKeys()
+	}
+	return ioutil.ReadFile(d.publicSSHKeyPath())
 }
 
-func (d *Driver) addSshKeyToServer(password string, sshKey []byte) error {
-	log.Info("Waiting for machine to be running, this may take a few minutes...")
-	if err := mcnutils.WaitFor(drivers.MachineInState(d, state.Running)); err != nil {
-		return fmt.Errorf("Error waiting for machine to be running: %s", err)
+// addSshKeyToServer waits for the VPS to run, unless the caller already
+// knows it does, and appends the machine key to the root authorized_keys.
+func (d *Driver) addSshKeyToServer(password string, sshKey []byte, running bool) error {
+	defer d.closeSshConnection()
+
+	if !running {
+		log.Info("Waiting for machine to be running, this may take a few minutes...")
+		if err := d.waitForState(state.Running, d.createTimeout()); err != nil {
+			return fmt.Errorf("Error waiting for machine to be running: %s", err)
+		}
 	}
 
 	log.Info("Waiting for SSH to be available...")
-	if err := mcnutils.WaitFor(d.sshAvailableFunc(password)); err != nil {
+	if err := d.waitFor(d.sshAvailableFunc(password), d.createTimeout()); err != nil {
 		return fmt.Errorf("Error waiting for ssh to be available: %s", err)
 	}
 
-	_, err := d.runSshCommand(
-		password,
-		"mkdir ~/.ssh && echo '"+string(sshKey)+"' >> ~/.ssh/authorized_keys",
-	)
+	d.waitForCloudInit(password)
+
+	_, err := d.runSshCommand(password, d.authorizeKeyCommand(sshKey))
 	return err
 }
 
+// waitForCloudInit lets cloud-init finish before the key is installed and
+// docker-machine provisions the machine, so they don't compete for the
+// package manager lock. Images without cloud-init return immediately.
+func (d *Driver) waitForCloudInit(password string) {
+	if d.CloudInitTimeout <= 0 {
+		return
+	}
+
+	log.Info("Waiting for cloud-init to finish...")
+	cmd := fmt.Sprintf(
+		"if [ -d /var/lib/cloud ]; then timeout %d sh -c 'cloud-init status --wait >/dev/null 2>&1 || until [ -f /var/lib/cloud/instance/boot-finished ]; do sleep 2; done'; fi",
+		d.CloudInitTimeout,
+	)
+	if _, err := d.runSshCommand(password, cmd); err != nil {
+		log.Warnf("cloud-init did not finish within %d seconds, continuing: %s", d.CloudInitTimeout, err)
+	}
+}
+
 func (d *Driver) sshAvailableFunc(password string) func() bool {
 	return func() bool {
 		log.Debug("Getting to WaitForSSH function...")
@@ -346,35 +2043,3 @@ func (d *Driver) sshAvailableFunc(password string) func() bool {
 		return true
 	}
 }
-
-func (d *Driver) runSshCommand(password string, cmd string) (string, error) {
-	c, err := d.getSshClient(password)
-	if err != nil {
-		return "", err
-	}
-
-	out, err := c.Output(cmd)
-	log.Debugf("Ssh command output: %s", out)
-
-	return out, err
-}
-
-func (d *Driver) getSshClient(password string) (ssh.Client, error) {
-	address, err := d.GetSSHHostname()
-	if err != nil {
-		return nil, err
-	}
-
-	port, err := d.GetSSHPort()
-	if err != nil {
-		return nil, err
-	}
-
-	auth := &ssh.Auth{
-		Passwords: []string{password},
-	}
-
-	ssh.SetDefaultClient(ssh.Native)
-
-	return ssh.NewClient(d.GetSSHUsername(), address, port, auth)
-}
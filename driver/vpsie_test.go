@@ -0,0 +1,328 @@
+package driver
+
+import (
+	"errors"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/jdextraze/go-vpsie"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusState(t *testing.T) {
+	tests := []struct {
+		status string
+		want   state.State
+		ok     bool
+	}{
+		{"Deleting", state.None, true},
+		{"Terminated", state.None, true},
+		{"Shutting down", state.Stopping, true},
+		{"Provisioning", state.Starting, true},
+		{"Rebooting", state.Starting, true},
+		{"Resizing", state.Starting, true},
+		{"Suspended", state.Paused, true},
+		{"Locked", state.Paused, true},
+		{"Powered off", state.Stopped, true},
+		{"Exploded", state.Error, false},
+	}
+
+	for _, test := range tests {
+		got, ok := statusState(test.status)
+		if got != test.want || ok != test.ok {
+			t.Errorf("statusState(%q) = %s, %t, want %s, %t", test.status, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestGetState(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		missing bool
+		getErr  error
+		want    state.State
+		wantErr bool
+	}{
+		{name: "running", status: "Running", want: state.Running},
+		{name: "started", status: "Started", want: state.Starting},
+		{name: "stopped", status: "Stopped", want: state.Stopped},
+		{name: "maintenance", status: "Under maintenance", want: state.Paused},
+		{name: "transitional", status: "Rebooting", want: state.Starting},
+		{name: "unknown", status: "Exploded", want: state.Error},
+		{name: "deleted", missing: true, want: state.None},
+		{name: "api error", getErr: errors.New("boom"), want: state.Error, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			if !test.missing {
+				client.instances = []vpsie.VPSie{{Id: "vps-1", Name: "test-machine", Status: test.status}}
+			}
+			client.getErr = test.getErr
+			d := newTestDriver(t, client)
+			d.InstanceID = "vps-1"
+
+			got, err := d.GetState()
+			if got != test.want || (err != nil) != test.wantErr {
+				t.Errorf("GetState() = %s, %v, want %s, error %t", got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLintFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		wantErr string
+	}{
+		{name: "defaults"},
+		{name: "client secret from stdin", values: map[string]interface{}{"vpsie-access-token": "", "vpsie-client-id": "id", "vpsie-client-secret": "-"}, wantErr: "stdin"},
+		{name: "two credential sources", values: map[string]interface{}{"vpsie-client-id": "id", "vpsie-client-secret": "secret"}, wantErr: "only one of"},
+		{name: "create timeout out of range", values: map[string]interface{}{"vpsie-create-timeout": 10}, wantErr: "--vpsie-create-timeout between 30 and 7200"},
+		{name: "negative billing alert", values: map[string]interface{}{"vpsie-billing-alert": -1}, wantErr: "--vpsie-billing-alert of at least 0"},
+		{name: "ipv6 address without ipv6", values: map[string]interface{}{"vpsie-use-ipv6": true}, wantErr: "requires --vpsie-ipv6"},
+		{name: "tag with comma", values: map[string]interface{}{"vpsie-tag": []string{"a,b"}}, wantErr: "Invalid --vpsie-tag"},
+		{name: "external id rewriting the note", values: map[string]interface{}{"vpsie-external-id": "x\nmachine-name=other"}, wantErr: "Invalid --vpsie-external-id"},
+		{name: "billing tag with equal sign", values: map[string]interface{}{"vpsie-billing-tag": "a=b"}, wantErr: "Invalid --vpsie-billing-tag"},
+		{name: "pool size without pool", values: map[string]interface{}{"vpsie-pool-size": 2}, wantErr: "requires the --vpsie-pool option"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newTestDriver(t, newFakeClient())
+			values := map[string]interface{}{"vpsie-access-token": "token"}
+			for key, value := range test.values {
+				values[key] = value
+			}
+
+			err := d.LintFlags(newTestOptions(d, values))
+			if test.wantErr == "" && err != nil {
+				t.Errorf("LintFlags() = %v, want no error", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("LintFlags() = %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetConfigFromFlags(t *testing.T) {
+	d := newTestDriver(t, newFakeClient())
+	if err := d.SetConfigFromFlags(newTestOptions(d, map[string]interface{}{"vpsie-access-token": "token"})); err != nil {
+		t.Fatalf("SetConfigFromFlags() = %v", err)
+	}
+	if d.StoreID == "" {
+		t.Error("SetConfigFromFlags() did not set the store ID")
+	}
+
+	other := NewDriver("other-machine", d.StorePath)
+	if err := other.SetConfigFromFlags(newTestOptions(other, map[string]interface{}{"vpsie-access-token": "token"})); err != nil {
+		t.Fatalf("SetConfigFromFlags() = %v", err)
+	}
+	if other.StoreID != d.StoreID {
+		t.Errorf("machines of the same store got store IDs %s and %s", d.StoreID, other.StoreID)
+	}
+
+	rejected := newTestDriver(t, newFakeClient())
+	err := rejected.SetConfigFromFlags(newTestOptions(rejected, map[string]interface{}{"vpsie-create-timeout": 1, "vpsie-access-token": "token"}))
+	if err == nil {
+		t.Error("SetConfigFromFlags() accepted an invalid create timeout")
+	}
+}
+
+func TestCreateVPSie(t *testing.T) {
+	defer func(delay time.Duration) { createRetryDelay = delay }(createRetryDelay)
+	createRetryDelay = time.Millisecond
+
+	tests := []struct {
+		name          string
+		failures      int
+		response      apiResponse
+		createdAnyway bool
+		fallbacks     []string
+		wantErr       bool
+		wantCreates   int
+		wantAdopted   bool
+		wantDC        string
+	}{
+		{name: "created", wantCreates: 1, wantDC: "dc-1"},
+		{name: "capacity error retried", failures: 2, response: apiResponse{StatusCode: http.StatusOK, Body: `{"error":true,"message":"Not enough resources"}`}, wantCreates: 3, wantDC: "dc-1"},
+		{name: "invalid request not retried", failures: 1, response: apiResponse{StatusCode: http.StatusBadRequest, Body: `{"error":true,"message":"Invalid offer"}`}, wantErr: true, wantCreates: 1},
+		{name: "created despite server error", failures: 1, response: apiResponse{StatusCode: http.StatusBadGateway}, createdAnyway: true, wantCreates: 1, wantAdopted: true, wantDC: "dc-1"},
+		{name: "fallback datacenter", failures: 4, response: apiResponse{StatusCode: http.StatusServiceUnavailable}, fallbacks: []string{"dc-2"}, wantCreates: 5, wantDC: "dc-2"},
+		{name: "retries exhausted", failures: 4, response: apiResponse{StatusCode: http.StatusServiceUnavailable}, wantErr: true, wantCreates: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			client.createFailures = test.failures
+			client.createResponse = test.response
+			client.createdAnyway = test.createdAnyway
+			d := newTestDriver(t, client)
+			d.DatacenterID = "dc-1"
+			d.FallbackDatacenterIDs = test.fallbacks
+			d.CreateRetries = 3
+
+			note := formatNote(d.metadata())
+			instance, err := d.createVPSie(vpsie.CreateVPSie{Hostname: "test-machine", DatacenterId: d.DatacenterID, Note: &note})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createVPSie() = %v, want error %t", err, test.wantErr)
+			}
+			if len(client.creates) != test.wantCreates {
+				t.Errorf("createVPSie() made %d creates, want %d", len(client.creates), test.wantCreates)
+			}
+			if len(client.instances) > 1 {
+				t.Errorf("createVPSie() left %d VPSes, want at most 1", len(client.instances))
+			}
+			if err != nil {
+				return
+			}
+			if instance.Id == "" {
+				t.Error("createVPSie() returned no VPS")
+			}
+			if adopted := len(client.passwordsChanged) > 0; adopted != test.wantAdopted {
+				t.Errorf("createVPSie() adopted the VPS: %t, want %t", adopted, test.wantAdopted)
+			}
+			if d.DatacenterID != test.wantDC {
+				t.Errorf("createVPSie() used datacenter %s, want %s", d.DatacenterID, test.wantDC)
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	t.Run("hostname taken", func(t *testing.T) {
+		client := newFakeClient(vpsie.VPSie{Id: "vps-9", Name: "test-machine"})
+		d := newTestDriver(t, client)
+
+		if err := d.Create(); err == nil || !strings.Contains(err.Error(), "already used") {
+			t.Errorf("Create() = %v, want a hostname conflict", err)
+		}
+		if len(client.creates) != 0 {
+			t.Errorf("Create() made %d creates, want none", len(client.creates))
+		}
+	})
+
+	t.Run("failure after create cleans up", func(t *testing.T) {
+		client := newFakeClient()
+		client.createdIPv4 = ""
+		client.createdStatus = "Provisioning"
+		d := newTestDriver(t, client)
+
+		if err := d.Create(); err == nil || !strings.Contains(err.Error(), "no IP address") {
+			t.Errorf("Create() = %v, want a missing address error", err)
+		}
+		if len(client.deleted) != 1 || client.deleted[0] != d.InstanceID {
+			t.Errorf("Create() deleted %v, want the created VPS %s", client.deleted, d.InstanceID)
+		}
+		if _, err := d.loadJournal(); err == nil {
+			t.Error("Create() kept the journal of the deleted VPS")
+		}
+	})
+
+	t.Run("failure kept with no cleanup", func(t *testing.T) {
+		client := newFakeClient()
+		client.createdIPv4 = ""
+		client.createdStatus = "Provisioning"
+		d := newTestDriver(t, client)
+		d.NoCleanupOnFailure = true
+
+		if err := d.Create(); err == nil {
+			t.Error("Create() succeeded without an IP address")
+		}
+		if len(client.deleted) != 0 {
+			t.Errorf("Create() deleted %v with --vpsie-no-cleanup-on-failure", client.deleted)
+		}
+		if j, err := d.loadJournal(); err != nil || j.InstanceID != d.InstanceID {
+			t.Errorf("Create() journal = %v, %v, want the created VPS", j, err)
+		}
+		if content, err := ioutil.ReadFile(d.journalPath()); err != nil || strings.Contains(string(content), client.createdPassword) {
+			t.Errorf("Create() journal = %s, %v, want no root password", content, err)
+		}
+	})
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name        string
+		instanceID  string
+		instances   []vpsie.VPSie
+		wantErr     string
+		wantDeleted bool
+	}{
+		{name: "owned", instanceID: "vps-1", instances: []vpsie.VPSie{{Id: "vps-1", Note: "machine-name=test-machine"}}, wantDeleted: true},
+		{name: "created before notes", instanceID: "vps-1", instances: []vpsie.VPSie{{Id: "vps-1"}}, wantDeleted: true},
+		{name: "already deleted", instanceID: "vps-1"},
+		{name: "other machine", instanceID: "vps-1", instances: []vpsie.VPSie{{Id: "vps-1", Note: "machine-name=other"}}, wantErr: "belongs to machine other"},
+		{name: "claimed before pools recorded claims", instanceID: "vps-1", instances: []vpsie.VPSie{{Id: "vps-1", Note: "pool=ci"}}, wantDeleted: true},
+		{name: "no ID with a VPS of the same name", instances: []vpsie.VPSie{{Id: "vps-1", Name: "test-machine"}}, wantErr: "set the InstanceID"},
+		{name: "no ID with a note naming the machine", instances: []vpsie.VPSie{{Id: "vps-1", Name: "x", Note: "machine-name=test-machine"}}, wantErr: "set the InstanceID"},
+		{name: "no ID and no VPS", instances: []vpsie.VPSie{{Id: "vps-1", Name: "test-machine", Note: "pool=ci"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient(test.instances...)
+			d := newTestDriver(t, client)
+			d.InstanceID = test.instanceID
+
+			err := d.Remove()
+			if test.wantErr == "" && err != nil {
+				t.Errorf("Remove() = %v, want no error", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("Remove() = %v, want an error containing %q", err, test.wantErr)
+			}
+			if deleted := len(client.deleted) > 0; deleted != test.wantDeleted {
+				t.Errorf("Remove() deleted %v, want deleted %t", client.deleted, test.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestGetClientKeepsSetupError(t *testing.T) {
+	d := newTestDriver(t, nil)
+	d.client = nil
+	d.Profile = "missing"
+
+	_, first := d.getClient().ListVPSie()
+	if first == nil {
+		t.Fatal("ListVPSie() succeeded without credentials")
+	}
+	if _, err := d.getClient().GetBalance(); err != first {
+		t.Errorf("GetBalance() = %v, want the setup error %v", err, first)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	client := newFakeClient(vpsie.VPSie{Id: "vps-1", Name: "test-machine", IpV4: "203.0.113.20"})
+	d := newTestDriver(t, client)
+	d.SkipValidation = true
+	d.InstanceID = "vps-1"
+	d.Hostname = "test-machine"
+	d.IPAddress = "203.0.113.10"
+
+	drifts, err := d.Drift()
+	if err != nil {
+		t.Fatalf("Drift() = %v", err)
+	}
+	found := false
+	for _, drift := range drifts {
+		if drift.Field == "hostname" {
+			t.Errorf("Drift() reported the unchanged hostname: %v", drift)
+		}
+		found = found || drift == Drift{"ip-address", "203.0.113.10", "203.0.113.20"}
+	}
+	if !found {
+		t.Errorf("Drift() = %v, want the IP address change", drifts)
+	}
+
+	d.InstanceID = "vps-2"
+	if drifts, err := d.Drift(); err == nil {
+		t.Errorf("Drift() = %v for a deleted VPS, want an error", drifts)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// health checks a provisioned machine's Docker daemon, since docker-machine
+// provisions Docker after the driver's Create has returned.
+func health(args []string) error {
+	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	withSSH := fs.Bool("ssh", false, "Also run docker info over SSH")
+	attempts := fs.Int("attempts", 10, "Attempts per check")
+	interval := fs.Duration("interval", 5*time.Second, "Delay between attempts")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("Usage: health [--ssh] [--attempts N] [--interval DURATION] MACHINE")
+	}
+
+	d, err := loadMachine(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := d.CheckDockerHealth(*withSSH, *attempts, *interval); err != nil {
+		return err
+	}
+
+	fmt.Printf("Docker on %s is healthy\n", fs.Arg(0))
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jdextraze/docker-machine-driver-vpsie/driver"
+)
+
+// lint validates driver options without any API call, for pipelines checking
+// machine definitions before deploying.
+func lint(args []string) error {
+	d := driver.NewDriver("", storePath())
+
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	options := newFlagOptions(fs, d.GetCreateFlags())
+	fs.Parse(args)
+	if err := options.readStdinSecret(); err != nil {
+		return err
+	}
+
+	if err := d.LintFlags(options); err != nil {
+		return err
+	}
+
+	fmt.Println("VPSie driver options are valid")
+	return nil
+}
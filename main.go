@@ -1,10 +1,59 @@
 package main
 
 import (
+	"fmt"
 	"github.com/docker/machine/libmachine/drivers/plugin"
 	"github.com/jdextraze/docker-machine-driver-vpsie/driver"
+	"os"
+	"sort"
+	"strings"
 )
 
+var commands = map[string]func(args []string) error{
+	"benchmark":        benchmark,
+	"drift":            drift,
+	"health":           health,
+	"lint":             lint,
+	"list-datacenters": listCatalog("datacenters"),
+	"list-images":      listCatalog("images"),
+	"list-offers":      listCatalog("offers"),
+	"orphans":          orphans,
+	"pool":             pool,
+	"resize":           resize,
+	"snapshot":         snapshot,
+	"support-bundle":   supportBundle,
+	"usage":            usage,
+}
+
 func main() {
+	// ssh-keygen and ssh-add run the binary as their askpass program to
+	// encrypt and decrypt machine keys.
+	if os.Getenv(driver.SSHAskPassEnv) == "1" {
+		fmt.Println(os.Getenv(driver.SSHKeyPassphraseEnv))
+		return
+	}
+
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown command %s, available commands: %s\n", os.Args[1], commandNames())
+			os.Exit(2)
+		}
+		if err := command(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	plugin.RegisterDriver(driver.NewDriver("", ""))
 }
+
+func commandNames() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jdextraze/docker-machine-driver-vpsie/driver"
+	"time"
+)
+
+const orphansUsage = "Usage: orphans [--remove (--yes | VPS_ID...)]"
+
+const snapshotUsage = "Usage: snapshot [create [--note NOTE] | list | delete] MACHINE [SNAPSHOT_NAME]"
+
+// snapshot creates, lists and deletes the snapshots recorded in the state of
+// a machine. Without a subcommand it creates a snapshot.
+func snapshot(args []string) error {
+	if len(args) == 0 {
+		return errors.New(snapshotUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return createSnapshot(args[1:])
+	case "list":
+		return listSnapshots(args[1:])
+	case "delete":
+		return deleteSnapshot(args[1:])
+	}
+	return createSnapshot(args)
+}
+
+func createSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot create", flag.ExitOnError)
+	note := fs.String("note", "", "Snapshot note")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return errors.New(snapshotUsage)
+	}
+
+	d, err := loadMachine(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := d.Snapshot(fs.Arg(1), *note); err != nil {
+		return err
+	}
+	if err := saveMachine(fs.Arg(0), d); err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot %s of %s requested\n", fs.Arg(1), fs.Arg(0))
+	return nil
+}
+
+func listSnapshots(args []string) error {
+	if len(args) != 1 {
+		return errors.New(snapshotUsage)
+	}
+
+	d, err := loadMachine(args[0])
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range d.Snapshots {
+		fmt.Printf("%s\t%s\t%s\n", snapshot.Name, snapshot.CreatedOn.Format(time.RFC3339), snapshot.Note)
+	}
+	return nil
+}
+
+func deleteSnapshot(args []string) error {
+	if len(args) != 2 {
+		return errors.New(snapshotUsage)
+	}
+
+	d, err := loadMachine(args[0])
+	if err != nil {
+		return err
+	}
+	if err := d.ForgetSnapshot(args[1]); err != nil {
+		return err
+	}
+	if err := saveMachine(args[0], d); err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot %s of %s removed from the machine, delete it from the VPSie panel\n", args[1], args[0])
+	return nil
+}
+
+// orphans lists VPSes created from this docker-machine store whose machine
+// no longer exists, and deletes the given ones, or all of them with --yes.
+func orphans(args []string) error {
+	d := driver.NewDriver("", storePath())
+
+	fs := flag.NewFlagSet("orphans", flag.ExitOnError)
+	remove := fs.Bool("remove", false, "Delete the orphaned VPSes given as arguments")
+	yes := fs.Bool("yes", false, "With --remove, delete every orphaned VPS")
+	options := newFlagOptions(fs, d.GetCreateFlags())
+	fs.Parse(args)
+	if err := options.readStdinSecret(); err != nil {
+		return err
+	}
+
+	// Deleting requires either the IDs of the VPSes or --yes, not both.
+	if *remove && *yes == (fs.NArg() > 0) || !*remove && (*yes || fs.NArg() > 0) {
+		return errors.New(orphansUsage)
+	}
+	selected := map[string]bool{}
+	for _, id := range fs.Args() {
+		selected[id] = true
+	}
+
+	if err := d.SetConfigFromFlags(options); err != nil {
+		return err
+	}
+
+	managed, err := d.ListManaged()
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range managed {
+		if machineExists(instance.MachineName) {
+			continue
+		}
+
+		fmt.Printf("%s\t%s\t%s\t%s\n", instance.Id, instance.MachineName, instance.IpV4, instance.Status)
+		if *remove && (*yes || selected[instance.Id]) {
+			if err := d.DeleteManaged(instance); err != nil {
+				return fmt.Errorf("Error deleting %s: %s", instance.Id, err)
+			}
+			delete(selected, instance.Id)
+		}
+	}
+
+	for id := range selected {
+		return fmt.Errorf("VPSie VPS %s is not an orphan of this store, it was not deleted", id)
+	}
+	return nil
+}
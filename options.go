@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/docker/machine/libmachine/mcnflag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// flagOptions exposes the driver create flags parsed from the command line
+// as drivers.DriverOptions, so standalone commands reuse SetConfigFromFlags.
+type flagOptions struct {
+	strings map[string]*string
+	slices  map[string]*stringSlice
+	ints    map[string]*int
+	bools   map[string]*bool
+}
+
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func newFlagOptions(fs *flag.FlagSet, createFlags []mcnflag.Flag) *flagOptions {
+	o := &flagOptions{
+		strings: map[string]*string{},
+		slices:  map[string]*stringSlice{},
+		ints:    map[string]*int{},
+		bools:   map[string]*bool{},
+	}
+
+	for _, f := range createFlags {
+		switch f := f.(type) {
+		case mcnflag.StringFlag:
+			value := f.Value
+			if env := os.Getenv(f.EnvVar); env != "" {
+				value = env
+			}
+			o.strings[f.Name] = fs.String(f.Name, value, f.Usage)
+		case mcnflag.StringSliceFlag:
+			value := stringSlice(f.Value)
+			if env := os.Getenv(f.EnvVar); env != "" {
+				value = strings.Split(env, ",")
+			}
+			o.slices[f.Name] = &value
+			fs.Var(&value, f.Name, f.Usage)
+		case mcnflag.IntFlag:
+			value := f.Value
+			if env, err := strconv.Atoi(os.Getenv(f.EnvVar)); err == nil {
+				value = env
+			}
+			o.ints[f.Name] = fs.Int(f.Name, value, f.Usage)
+		case mcnflag.BoolFlag:
+			value, _ := strconv.ParseBool(os.Getenv(f.EnvVar))
+			o.bools[f.Name] = fs.Bool(f.Name, value, f.Usage)
+		}
+	}
+
+	return o
+}
+
+func (o *flagOptions) String(key string) string {
+	if value, ok := o.strings[key]; ok {
+		return *value
+	}
+	return ""
+}
+
+func (o *flagOptions) StringSlice(key string) []string {
+	if value, ok := o.slices[key]; ok {
+		return *value
+	}
+	return nil
+}
+
+func (o *flagOptions) Int(key string) int {
+	if value, ok := o.ints[key]; ok {
+		return *value
+	}
+	return 0
+}
+
+func (o *flagOptions) Bool(key string) bool {
+	if value, ok := o.bools[key]; ok {
+		return *value
+	}
+	return false
+}
+
+// readStdinSecret reads the client secret from stdin when it is given as -.
+// The standalone commands run attached to the terminal, unlike the plugin
+// process docker-machine starts, so only they accept it.
+func (o *flagOptions) readStdinSecret() error {
+	secret, ok := o.strings["vpsie-client-secret"]
+	if !ok || *secret != "-" {
+		return nil
+	}
+	value, err := readSecret(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("Error reading VPSie client secret from stdin: %s", err)
+	}
+	*secret = value
+	return nil
+}
+
+// readSecret reads a single line one byte at a time so nothing past it is
+// consumed from stdin.
+func readSecret(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line)), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jdextraze/docker-machine-driver-vpsie/driver"
+	"time"
+)
+
+const poolUsage = "Usage: pool fill|list --vpsie-pool NAME [--vpsie-pool-size N] ..."
+
+// pool fills and lists the warm pools Create claims VPSes from.
+func pool(args []string) error {
+	if len(args) == 0 {
+		return errors.New(poolUsage)
+	}
+
+	d := driver.NewDriver("", storePath())
+	fs := flag.NewFlagSet("pool "+args[0], flag.ExitOnError)
+	options := newFlagOptions(fs, d.GetCreateFlags())
+	fs.Parse(args[1:])
+	if err := options.readStdinSecret(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "fill":
+		if err := d.SetConfigFromFlags(options); err != nil {
+			return err
+		}
+		if d.Pool == "" || d.PoolSize <= 0 {
+			return errors.New(poolUsage)
+		}
+		if err := d.PreCreateCheck(); err != nil {
+			return err
+		}
+		created, err := d.FillPool(d.PoolSize)
+		fmt.Printf("Created %d VPSes in pool %s\n", created, d.Pool)
+		return err
+	case "list":
+		d.Pool = options.String("vpsie-pool")
+		if d.Pool == "" {
+			return errors.New(poolUsage)
+		}
+		instances, err := d.PooledInstances()
+		if err != nil {
+			return err
+		}
+		for _, instance := range instances {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n", instance.InstanceID, instance.IPAddress, instance.OfferID, instance.ImageID, instance.DatacenterID, instance.CreatedOn.Format(time.RFC3339))
+		}
+		return nil
+	}
+	return errors.New(poolUsage)
+}
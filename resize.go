@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// resize moves a machine to another VPSie offer, as docker-machine has no
+// command changing the size of a machine.
+func resize(args []string) error {
+	fs := flag.NewFlagSet("resize", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return errors.New("Usage: resize MACHINE OFFER")
+	}
+	name, offer := fs.Arg(0), fs.Arg(1)
+
+	d, err := loadMachine(name)
+	if err != nil {
+		return err
+	}
+	if err := d.Resize(offer); err != nil {
+		return err
+	}
+	if err := saveMachine(name, d); err != nil {
+		return err
+	}
+
+	fmt.Printf("Resized %s to %d vCPU, %d MB RAM and %d GB SSD\n", name, d.CPU, d.RAM, d.Disk)
+	return nil
+}
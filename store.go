@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/jdextraze/docker-machine-driver-vpsie/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func storePath() string {
+	if path := os.Getenv("MACHINE_STORAGE_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(mcnutils.GetHomeDir(), ".docker", "machine")
+}
+
+func machineExists(name string) bool {
+	_, err := os.Stat(machineConfigPath(name))
+	return err == nil
+}
+
+func machineConfigPath(name string) string {
+	return filepath.Join(storePath(), "machines", name, "config.json")
+}
+
+// loadMachine reads the driver state docker-machine saved for a machine.
+func loadMachine(name string) (*driver.Driver, error) {
+	content, err := ioutil.ReadFile(machineConfigPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	host := struct {
+		DriverName string
+		Driver     *driver.Driver
+	}{
+		Driver: driver.NewDriver(name, storePath()),
+	}
+	if err := json.Unmarshal(content, &host); err != nil {
+		return nil, err
+	}
+
+	if host.DriverName != host.Driver.DriverName() {
+		return nil, fmt.Errorf("Machine %s uses the %s driver", name, host.DriverName)
+	}
+	return host.Driver, nil
+}
+
+// saveMachine writes the driver state back, keeping the rest of the host
+// configuration docker-machine saved untouched.
+func saveMachine(name string, d *driver.Driver) error {
+	path := machineConfigPath(name)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	host := map[string]json.RawMessage{}
+	if err := json.Unmarshal(content, &host); err != nil {
+		return err
+	}
+	if host["Driver"], err = json.Marshal(d); err != nil {
+		return err
+	}
+
+	if content, err = json.MarshalIndent(host, "", "    "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0600)
+}
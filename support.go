@@ -0,0 +1,146 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var sensitiveKey = regexp.MustCompile(`(?i)secret|password|token|passphrase`)
+
+// supportCommands are run over SSH with --ssh to collect the provisioning
+// logs of the machine.
+var supportCommands = map[string]string{
+	"cloud-init-output.log": "tail -n 500 /var/log/cloud-init-output.log",
+	"docker-journal.log":    "journalctl -u docker --no-pager -n 500 || tail -n 500 /var/log/docker.log",
+	"docker-info.txt":       "docker info",
+	"df.txt":                "df -h",
+}
+
+// supportBundle collects what is needed to troubleshoot a machine into a
+// single archive, with credentials and passwords redacted.
+func supportBundle(args []string) error {
+	fs := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	output := fs.String("o", "", "Archive path (default vpsie-support-MACHINE.tar.gz)")
+	withSSH := fs.Bool("ssh", false, "Also collect provisioning logs over SSH")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("Usage: support-bundle [-o FILE] [--ssh] MACHINE")
+	}
+	name := fs.Arg(0)
+	if *output == "" {
+		*output = fmt.Sprintf("vpsie-support-%s.tar.gz", name)
+	}
+
+	files := map[string][]byte{}
+	addJSON := func(file string, v interface{}) {
+		if content, err := json.MarshalIndent(v, "", "    "); err == nil {
+			files[file] = content
+		}
+	}
+	addError := func(file string, err error) {
+		files[file+".error"] = []byte(err.Error())
+	}
+
+	config, err := ioutil.ReadFile(machineConfigPath(name))
+	if err != nil {
+		return err
+	}
+	host := map[string]interface{}{}
+	if err := json.Unmarshal(config, &host); err != nil {
+		return err
+	}
+	addJSON("config.json", redact(host))
+
+	machineDir := filepath.Dir(machineConfigPath(name))
+	if journal, err := ioutil.ReadFile(filepath.Join(machineDir, "vpsie-journal.json")); err == nil {
+		var v interface{}
+		if json.Unmarshal(journal, &v) == nil {
+			addJSON("journal.json", redact(v))
+		}
+	}
+
+	d, err := loadMachine(name)
+	if err != nil {
+		return err
+	}
+	if instance, err := d.LiveInstance(); err != nil {
+		addError("vpsie.json", err)
+	} else {
+		addJSON("vpsie.json", instance)
+	}
+	if drifts, err := d.Drift(); err != nil {
+		addError("drift.json", err)
+	} else {
+		addJSON("drift.json", drifts)
+	}
+
+	if *withSSH {
+		for file, cmd := range supportCommands {
+			out, err := d.RunAsRoot(cmd)
+			if err != nil {
+				addError(file, err)
+			}
+			files[file] = []byte(out)
+		}
+	}
+
+	if err := writeArchive(*output, files); err != nil {
+		return err
+	}
+	fmt.Printf("Support bundle for %s written to %s\n", name, *output)
+	return nil
+}
+
+// redact replaces the values of credential fields, whatever their nesting.
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && s != "" && sensitiveKey.MatchString(key) {
+				v[key] = "<redacted>"
+			} else {
+				v[key] = redact(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redact(value)
+		}
+	}
+	return v
+}
+
+func writeArchive(path string, files map[string][]byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for file, content := range files {
+		header := &tar.Header{Name: file, Mode: 0600, Size: int64(len(content)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
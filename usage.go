@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// usage prints the disk and network statistics of a machine with its traffic
+// cap. VPSie only reports samples of a recent period, so the monthly traffic
+// cannot be compared with the cap.
+func usage(args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	withSSH := fs.Bool("ssh", false, "Also read the free disk space over SSH")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("Usage: usage [--ssh] MACHINE")
+	}
+
+	d, err := loadMachine(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	u, err := d.Usage(*withSSH)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Period:\t%s - %s, %d samples in the units of VPSie\n", u.From, u.To, u.Samples)
+	fmt.Printf("Network in:\t%d latest, %d average\n", u.NetIn.Latest, u.NetIn.Average)
+	fmt.Printf("Network out:\t%d latest, %d average\n", u.NetOut.Latest, u.NetOut.Average)
+	fmt.Printf("Disk read:\t%d latest, %d average\n", u.DiskRead.Latest, u.DiskRead.Average)
+	fmt.Printf("Disk write:\t%d latest, %d average\n", u.DiskWrite.Latest, u.DiskWrite.Average)
+	if u.TrafficCap > 0 {
+		fmt.Printf("Traffic cap:\t%d GB per month, the monthly traffic is not available from the VPSie API\n", u.TrafficCap)
+	}
+	if u.FreeDisk >= 0 {
+		fmt.Printf("Disk:\t%d GB free of %d GB\n", u.FreeDisk, u.Disk)
+	} else {
+		fmt.Printf("Disk:\t%d GB\n", u.Disk)
+	}
+	return nil
+}